@@ -0,0 +1,208 @@
+// Package boltstore implements kvmapstruct.Store with bbolt, an embedded
+// single file key/value database. Key segments are nested buckets under
+// a root bucket: the key app/DB/Host is the key Host of the bucket DB of
+// the bucket app.
+//
+//	store, err := boltstore.Open("/var/lib/app/config.db", 0600)
+//	defer store.Close()
+//	err = kvmapstruct.Save(ctx, store, "app", cfg)
+//	cfg, err := kvmapstruct.Load[Config](ctx, store, "app")
+package boltstore
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cast"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/uthng/kvmapstruct/internal/kvpath"
+)
+
+// DefaultBucket is the default name of the root bucket.
+const DefaultBucket = "kvmapstruct"
+
+// Store contains bbolt informations.
+type Store struct {
+	// DB is bbolt database
+	DB *bolt.DB
+	// Bucket is the name of the root bucket of the keys
+	Bucket string
+}
+
+// Open opens or creates the bbolt database file filename and returns
+// a new *Store using DefaultBucket. It fails after one second if the
+// file is locked by another process.
+func Open(filename string, mode os.FileMode) (*Store, error) {
+	db, err := bolt.Open(filename, mode, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	return NewFromDB(db, DefaultBucket), nil
+}
+
+// NewFromDB creates a new *Store with an opened bbolt database.
+// Keys are stored under the root bucket named bucket.
+func NewFromDB(db *bolt.DB, bucket string) *Store {
+	return &Store{
+		DB:     db,
+		Bucket: bucket,
+	}
+}
+
+// Close closes the bbolt database.
+func (s *Store) Close() error {
+	return s.DB.Close()
+}
+
+// List implements kvmapstruct.Store. The prefix can be a bucket or a key.
+func (s *Store) List(ctx context.Context, prefix string) (map[string]interface{}, error) {
+	m := make(map[string]interface{})
+	segments := kvpath.Split(prefix)
+
+	err := s.DB.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(s.Bucket))
+
+		for i, segment := range segments {
+			if b == nil {
+				return nil
+			}
+
+			// The last segment can be a key
+			if i == len(segments)-1 {
+				if v := b.Get([]byte(segment)); v != nil {
+					m[strings.Join(segments, "/")] = string(v)
+					return nil
+				}
+			}
+
+			b = b.Bucket([]byte(segment))
+		}
+
+		if b == nil {
+			return nil
+		}
+
+		return walkBucket(b, strings.Join(segments, "/"), m)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// Put implements kvmapstruct.Store. All kv pairs are written in
+// a single transaction: either all of them are saved or none.
+func (s *Store) Put(ctx context.Context, kvmap map[string]interface{}) error {
+	return s.DB.Update(func(tx *bolt.Tx) error {
+		return s.put(tx, kvmap)
+	})
+}
+
+// Replace deletes all keys under prefix and writes the kv pairs of kvmap
+// in a single transaction. It is intended to mirror another store, as a
+// local cache for example.
+func (s *Store) Replace(ctx context.Context, prefix string, kvmap map[string]interface{}) error {
+	return s.DB.Update(func(tx *bolt.Tx) error {
+		err := s.delete(tx, prefix)
+		if err != nil {
+			return err
+		}
+
+		return s.put(tx, kvmap)
+	})
+}
+
+// Delete deletes all keys under prefix in a single transaction.
+func (s *Store) Delete(ctx context.Context, prefix string) error {
+	return s.DB.Update(func(tx *bolt.Tx) error {
+		return s.delete(tx, prefix)
+	})
+}
+
+// put writes the kv pairs of kvmap in tx, creating missing buckets.
+func (s *Store) put(tx *bolt.Tx, kvmap map[string]interface{}) error {
+	root, err := tx.CreateBucketIfNotExists([]byte(s.Bucket))
+	if err != nil {
+		return err
+	}
+
+	for k, v := range kvmap {
+		segments := kvpath.Split(k)
+		if len(segments) == 0 {
+			return fmt.Errorf("invalid key %q", k)
+		}
+
+		b := root
+		for _, segment := range segments[:len(segments)-1] {
+			b, err = b.CreateBucketIfNotExists([]byte(segment))
+			if err != nil {
+				return fmt.Errorf("error writing key %s: %s", k, err)
+			}
+		}
+
+		err = b.Put([]byte(segments[len(segments)-1]), []byte(cast.ToString(v)))
+		if err != nil {
+			return fmt.Errorf("error writing key %s: %s", k, err)
+		}
+	}
+
+	return nil
+}
+
+// delete deletes the key or the bucket prefix in tx.
+func (s *Store) delete(tx *bolt.Tx, prefix string) error {
+	segments := kvpath.Split(prefix)
+
+	if len(segments) == 0 {
+		if tx.Bucket([]byte(s.Bucket)) == nil {
+			return nil
+		}
+
+		return tx.DeleteBucket([]byte(s.Bucket))
+	}
+
+	b := tx.Bucket([]byte(s.Bucket))
+	for _, segment := range segments[:len(segments)-1] {
+		if b == nil {
+			return nil
+		}
+
+		b = b.Bucket([]byte(segment))
+	}
+
+	if b == nil {
+		return nil
+	}
+
+	last := []byte(segments[len(segments)-1])
+	if b.Bucket(last) != nil {
+		return b.DeleteBucket(last)
+	}
+
+	return b.Delete(last)
+}
+
+// walkBucket reads recursively the keys of bucket b into m.
+func walkBucket(b *bolt.Bucket, prefix string, m map[string]interface{}) error {
+	return b.ForEach(func(k, v []byte) error {
+		key := string(k)
+		if prefix != "" {
+			key = prefix + "/" + key
+		}
+
+		// Nested buckets have no value
+		if v == nil {
+			return walkBucket(b.Bucket(k), key, m)
+		}
+
+		m[key] = string(v)
+
+		return nil
+	})
+}
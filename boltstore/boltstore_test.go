@@ -0,0 +1,117 @@
+package boltstore
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/uthng/kvmapstruct/internal/storetest"
+)
+
+func openTestStore(t *testing.T) (*Store, func()) {
+	dir, err := ioutil.TempDir("", "boltstore")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	store, err := Open(filepath.Join(dir, "test.db"), 0600)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("%s", err)
+	}
+
+	return store, func() {
+		store.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestStore(t *testing.T) {
+	store, stop := openTestStore(t)
+	defer stop()
+
+	storetest.Run(t, store, "app")
+
+	// Key segments are nested buckets
+	err := store.DB.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket([]byte(DefaultBucket)).Bucket([]byte("app")).Bucket([]byte("DB")).Get([]byte("Host"))
+		if string(v) != "db.prod" {
+			t.Errorf("wrong key app/DB/Host: %s", v)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+}
+
+func TestStoreTransactions(t *testing.T) {
+	ctx := context.Background()
+
+	store, stop := openTestStore(t)
+	defer stop()
+
+	err := store.Put(ctx, map[string]interface{}{
+		"app/Env":     "prod",
+		"app/Hosts/0": "host1",
+		"app/Hosts/1": "host2",
+		"other/Env":   "dev",
+	})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	// A key can not be a bucket: nothing is written
+	err = store.Put(ctx, map[string]interface{}{
+		"app/Workers":  "4",
+		"app/Env/Name": "prod",
+	})
+	if err == nil {
+		t.Fatalf("key under a value written")
+	}
+
+	m, err := store.List(ctx, "app/Workers")
+	if err != nil || len(m) != 0 {
+		t.Errorf("partial write: %v %v", m, err)
+	}
+
+	err = store.Replace(ctx, "app", map[string]interface{}{
+		"app/Env":     "dev",
+		"app/Hosts/0": "host3",
+	})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	m, err = store.List(ctx, "")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	want := map[string]interface{}{
+		"app/Env":     "dev",
+		"app/Hosts/0": "host3",
+		"other/Env":   "dev",
+	}
+
+	if !reflect.DeepEqual(m, want) {
+		t.Errorf("\nwant:\n%v\nhave:\n%v", want, m)
+	}
+
+	err = store.Delete(ctx, "other/Env")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	m, err = store.List(ctx, "other")
+	if err != nil || len(m) != 0 {
+		t.Errorf("key not deleted: %v %v", m, err)
+	}
+
+}
@@ -0,0 +1,299 @@
+package kvmapstruct
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// CacheVersion is the format version of cache files created by this package.
+const CacheVersion = 1
+
+// CacheRefreshInterval is the time a CachedStore waits between two
+// attempts to read a stale prefix from its store again.
+var CacheRefreshInterval = 10 * time.Second
+
+// CachedStore is a read-through cache of a Store. The KV map of each
+// prefix successfully listed is persisted to a local file. When the
+// store fails, List falls back to the cached KV map, flags the prefix
+// as stale and refreshes it in the background until the store recovers.
+// Values are cached as read from the store: secret fields stay
+// encrypted on disk.
+//
+//	store := kvmapstruct.NewCachedStore(kms, "/var/cache/app/config.json")
+//	defer store.Close()
+//	cfg, err := kvmapstruct.Load[Config](ctx, store, "app")
+//	if _, stale := store.Stale("app"); stale {
+//		log.Printf("consul unreachable, using cached config")
+//	}
+type CachedStore struct {
+	// Store is the cached store
+	Store Store
+	// File is the cache file
+	File string
+	// OnSaveError, if set, is called when the KV map of prefix
+	// read from the store can not be written to File
+	OnSaveError func(prefix string, err error)
+
+	mu      sync.Mutex
+	stale   map[string]time.Time
+	saveErr error
+	ctx     context.Context
+	cancel  context.CancelFunc
+}
+
+// cacheFile is the content of a cache file.
+type cacheFile struct {
+	Version int                   `json:"version"`
+	Entries map[string]cacheEntry `json:"entries"`
+}
+
+// cacheEntry is the cached KV map of a prefix.
+type cacheEntry struct {
+	CachedAt time.Time              `json:"cached_at"`
+	KVMap    map[string]interface{} `json:"kvmap"`
+}
+
+// NewCachedStore creates a new *CachedStore caching the KV maps
+// read from store in file.
+func NewCachedStore(store Store, file string) *CachedStore {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &CachedStore{
+		Store:  store,
+		File:   file,
+		stale:  make(map[string]time.Time),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// Close stops the background refreshes. It does not close the store.
+func (c *CachedStore) Close() error {
+	c.cancel()
+	return nil
+}
+
+// List implements Store. If the store fails, the cached KV map of
+// prefix is returned, if any, and prefix is stale until the store
+// is read successfully again.
+func (c *CachedStore) List(ctx context.Context, prefix string) (map[string]interface{}, error) {
+	m, err := c.Store.List(ctx, prefix)
+	if err == nil {
+		c.mu.Lock()
+		delete(c.stale, prefix)
+		c.mu.Unlock()
+
+		// A failed write only loses the fallback, not the read
+		c.cache(prefix, m)
+
+		return m, nil
+	}
+
+	entry, ok, cerr := c.load(prefix)
+	if cerr != nil {
+		return nil, fmt.Errorf("%s (cache: %s)", err, cerr)
+	}
+
+	if !ok {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	_, refreshing := c.stale[prefix]
+	c.stale[prefix] = entry.CachedAt
+	c.mu.Unlock()
+
+	if !refreshing {
+		go c.refresh(prefix, CacheRefreshInterval)
+	}
+
+	return entry.KVMap, nil
+}
+
+// Put implements Store. Kv pairs are written to the store only:
+// the cache is updated by the next successful List.
+func (c *CachedStore) Put(ctx context.Context, kvmap map[string]interface{}) error {
+	return c.Store.Put(ctx, kvmap)
+}
+
+// Stale returns the time the KV map of prefix was cached at and true
+// if the last List of prefix was served from the cache because
+// the store failed.
+func (c *CachedStore) Stale(prefix string) (time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t, ok := c.stale[prefix]
+
+	return t, ok
+}
+
+// SaveError returns the error of the last write to the cache file,
+// nil if it succeeded. Reads do not fail when the cache can not be
+// written, but the fallback is then missing at the next outage.
+func (c *CachedStore) SaveError() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.saveErr
+}
+
+// encryptKVMap implements secretStore if the store does.
+func (c *CachedStore) encryptKVMap(m map[string]interface{}, secrets []structField) error {
+	if s, ok := c.Store.(secretStore); ok {
+		return s.encryptKVMap(m, secrets)
+	}
+
+	return nil
+}
+
+// decryptKVMap implements secretStore if the store does.
+func (c *CachedStore) decryptKVMap(m map[string]interface{}, secrets []structField) error {
+	if s, ok := c.Store.(secretStore); ok {
+		return s.decryptKVMap(m, secrets)
+	}
+
+	return nil
+}
+
+// refresh reads prefix from the store every interval until it
+// succeeds, prefix is no longer stale or the cached store is closed.
+func (c *CachedStore) refresh(prefix string, interval time.Duration) {
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+
+		if _, ok := c.Stale(prefix); !ok {
+			return
+		}
+
+		m, err := c.Store.List(c.ctx, prefix)
+		if err != nil {
+			continue
+		}
+
+		c.mu.Lock()
+		delete(c.stale, prefix)
+		c.mu.Unlock()
+
+		c.cache(prefix, m)
+
+		return
+	}
+}
+
+// cache saves the KV map of prefix to the cache file and reports
+// the error, if any, to SaveError and OnSaveError.
+func (c *CachedStore) cache(prefix string, m map[string]interface{}) {
+	err := c.save(prefix, m)
+
+	c.mu.Lock()
+	c.saveErr = err
+	c.mu.Unlock()
+
+	if err != nil && c.OnSaveError != nil {
+		c.OnSaveError(prefix, err)
+	}
+}
+
+// load returns the cached KV map of prefix and true if it exists.
+func (c *CachedStore) load(prefix string) (cacheEntry, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	f, err := c.readFile()
+	if err != nil {
+		return cacheEntry{}, false, err
+	}
+
+	entry, ok := f.Entries[prefix]
+
+	return entry, ok, nil
+}
+
+// save writes the KV map of prefix to the cache file.
+func (c *CachedStore) save(prefix string, m map[string]interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	f, err := c.readFile()
+	if err != nil {
+		// Corrupted or outdated caches are overwritten
+		f = &cacheFile{Version: CacheVersion, Entries: make(map[string]cacheEntry)}
+	}
+
+	f.Entries[prefix] = cacheEntry{
+		CachedAt: time.Now().UTC(),
+		KVMap:    m,
+	}
+
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(c.File, data, 0600)
+}
+
+// readFile reads the cache file. A missing file is an empty cache.
+func (c *CachedStore) readFile() (*cacheFile, error) {
+	f := &cacheFile{}
+
+	data, err := ioutil.ReadFile(c.File)
+	if os.IsNotExist(err) {
+		return &cacheFile{Version: CacheVersion, Entries: make(map[string]cacheEntry)}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, f)
+	if err != nil {
+		return nil, err
+	}
+
+	if f.Version != CacheVersion {
+		return nil, fmt.Errorf("cache version %d not supported", f.Version)
+	}
+
+	if f.Entries == nil {
+		f.Entries = make(map[string]cacheEntry)
+	}
+
+	return f, nil
+}
+
+// writeFileAtomic writes data to a temporary file renamed to filename,
+// so that readers never see a partially written file.
+func writeFileAtomic(filename string, data []byte, perm os.FileMode) error {
+	f, err := ioutil.TempFile(filepath.Dir(filename), ".tmp-")
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Chmod(perm)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), filename)
+	}
+
+	if err != nil {
+		os.Remove(f.Name())
+	}
+
+	return err
+}
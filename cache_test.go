@@ -0,0 +1,182 @@
+package kvmapstruct
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// downStore is a Store failing while down is set.
+type downStore struct {
+	*memStore
+
+	mu   sync.Mutex
+	down bool
+}
+
+func (s *downStore) setDown(down bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.down = down
+}
+
+func (s *downStore) List(ctx context.Context, prefix string) (map[string]interface{}, error) {
+	s.mu.Lock()
+	down := s.down
+	s.mu.Unlock()
+
+	if down {
+		return nil, fmt.Errorf("connection refused")
+	}
+
+	return s.memStore.List(ctx, prefix)
+}
+
+func TestCachedStore(t *testing.T) {
+	type config struct {
+		Env     string
+		Workers int
+	}
+
+	ctx := context.Background()
+
+	defer func(d time.Duration) { CacheRefreshInterval = d }(CacheRefreshInterval)
+	CacheRefreshInterval = 10 * time.Millisecond
+
+	dir, err := ioutil.TempDir("", "kvmapstruct")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	backend := &downStore{memStore: newMemStore()}
+	file := filepath.Join(dir, "cache.json")
+
+	store := NewCachedStore(backend, file)
+	defer store.Close()
+
+	// Nothing cached yet: errors of the store are returned
+	backend.setDown(true)
+
+	_, err = Load[config](ctx, store, "app")
+	if err == nil {
+		t.Fatalf("no error without cache")
+	}
+
+	backend.setDown(false)
+
+	want := config{Env: "prod", Workers: 4}
+
+	err = Save(ctx, store, "app", want)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	_, err = Load[config](ctx, store, "app")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if _, stale := store.Stale("app"); stale {
+		t.Errorf("fresh read flagged as stale")
+	}
+
+	if store.SaveError() != nil {
+		t.Errorf("%s", store.SaveError())
+	}
+
+	// A new process boots while the store is down
+	backend.setDown(true)
+
+	store = NewCachedStore(backend, file)
+	defer store.Close()
+
+	out, err := Load[config](ctx, store, "app")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if !reflect.DeepEqual(out, want) {
+		t.Errorf("\nwant:\n%v\nhave:\n%v", want, out)
+	}
+
+	if _, stale := store.Stale("app"); !stale {
+		t.Errorf("cached read not flagged as stale")
+	}
+
+	// Other prefixes were never cached
+	_, err = store.List(ctx, "other")
+	if err == nil {
+		t.Errorf("no error for a prefix not cached")
+	}
+
+	// The stale prefix is refreshed once the store recovers
+	err = backend.memStore.Put(ctx, map[string]interface{}{"app/Workers": "8"})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	backend.setDown(false)
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, stale := store.Stale("app"); !stale {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("stale prefix not refreshed")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	backend.setDown(true)
+
+	out, err = Load[config](ctx, store, "app")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if out.Workers != 8 {
+		t.Errorf("cache not refreshed: %v", out)
+	}
+
+}
+
+func TestCachedStoreSaveError(t *testing.T) {
+	ctx := context.Background()
+
+	backend := &downStore{memStore: newMemStore()}
+
+	err := backend.Put(ctx, map[string]interface{}{"app/Env": "prod"})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	var failed []string
+
+	// The cache directory does not exist
+	store := NewCachedStore(backend, filepath.Join(os.TempDir(), "missing-kvmapstruct", "cache.json"))
+	store.OnSaveError = func(prefix string, err error) {
+		failed = append(failed, prefix)
+	}
+	defer store.Close()
+
+	m, err := store.List(ctx, "app")
+	if err != nil || m["app/Env"] != "prod" {
+		t.Fatalf("wrong list %v: %v", m, err)
+	}
+
+	if store.SaveError() == nil || !reflect.DeepEqual(failed, []string{"app"}) {
+		t.Errorf("save error not reported: %v %v", store.SaveError(), failed)
+	}
+
+}
@@ -0,0 +1,297 @@
+package kvmapstruct
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cast"
+
+	"github.com/uthng/kvmapstruct/internal/kvpath"
+)
+
+// CheckIssueType is the kind of problem found by Check.
+type CheckIssueType string
+
+const (
+	// CheckUnknown means a key does not match any struct field.
+	CheckUnknown CheckIssueType = "unknown"
+	// CheckMismatch means a value cannot be converted to the field type.
+	CheckMismatch CheckIssueType = "mismatch"
+	// CheckMissing means a key of a field with the nonempty rule is missing.
+	CheckMissing CheckIssueType = "missing"
+	// CheckInvalid means a decoded value does not pass validation.
+	CheckInvalid CheckIssueType = "invalid"
+)
+
+// CheckIssue is a problem found at a Consul key by Check.
+type CheckIssue struct {
+	Key     string         `json:"key"`
+	Field   string         `json:"field,omitempty"`
+	Type    CheckIssueType `json:"type"`
+	Message string         `json:"message"`
+}
+
+// CheckReport contains all problems found by Check, sorted by key.
+type CheckReport struct {
+	Path   string       `json:"path"`
+	Issues []CheckIssue `json:"issues"`
+}
+
+// Check verifies that the kv pairs under kvmapstruct path can be decoded
+// into a Go struct of the type of outType and pass its validation,
+// without decoding into outType nor writing anything to Consul.
+// outType argument can be a Go struct or a pointer to a Go struct,
+// initialized or not. Secret values are decrypted with KeyProvider.
+func (kms *KVMapStruct) Check(outType interface{}) (*CheckReport, error) {
+	var issues []CheckIssue
+
+	m := make(map[string]interface{})
+
+	pairs, err := kms.listKVPairs()
+	if err != nil {
+		return nil, err
+	}
+
+	secrets := secretFields(reflect.TypeOf(outType), kms.Path)
+
+	for _, kv := range pairs {
+		f, ok := findField(secrets, kv.Key)
+		if !ok {
+			m[kv.Key] = string(kv.Value)
+			continue
+		}
+
+		v, err := decryptValue(kms.KeyProvider, kv.Value)
+		if err != nil {
+			issues = append(issues, CheckIssue{
+				Key:     kv.Key,
+				Field:   f.Path,
+				Type:    CheckMismatch,
+				Message: fmt.Sprintf("cannot decrypt secret value: %s", err),
+			})
+			continue
+		}
+
+		m[kv.Key] = string(v)
+	}
+
+	report := CheckKVMap(m, kms.Path, outType)
+	report.Path = kms.Path
+	report.Issues = append(report.Issues, issues...)
+	report.sort()
+
+	return report, nil
+}
+
+// CheckKVMap verifies that a KV map can be decoded by KVMapToStruct
+// into a Go struct of the type of outType. It reports keys matching
+// no field, values that cannot be converted to their field type,
+// missing keys of fields with the nonempty rule and, if there is no
+// other issue, validation errors of the decoded struct.
+// Neither in nor outType is modified.
+func CheckKVMap(in map[string]interface{}, prefix string, outType interface{}) *CheckReport {
+	report := &CheckReport{
+		Path:   prefix,
+		Issues: []CheckIssue{},
+	}
+
+	t := reflect.TypeOf(outType)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t == nil || t.Kind() != reflect.Struct {
+		report.Issues = append(report.Issues, CheckIssue{
+			Key:     prefix,
+			Type:    CheckMismatch,
+			Message: "output type is not a Go struct",
+		})
+		return report
+	}
+
+	fields := structFields(t, prefix)
+	found := make(map[string]bool)
+
+	for k, v := range in {
+		if strings.HasSuffix(k, "/") || !kvpath.InPath(k, prefix) {
+			continue
+		}
+
+		f, ok := findField(fields, k)
+		if !ok {
+			report.Issues = append(report.Issues, CheckIssue{
+				Key:     k,
+				Type:    CheckUnknown,
+				Message: "key does not match any field",
+			})
+			continue
+		}
+
+		found[f.Key] = true
+
+		msg := checkKind(f, k, v)
+		if msg != "" {
+			report.Issues = append(report.Issues, CheckIssue{
+				Key:     k,
+				Field:   f.Path,
+				Type:    CheckMismatch,
+				Message: msg,
+			})
+		}
+	}
+
+	for _, f := range fields {
+		if !found[f.Key] && hasRule(f.Field, "nonempty") {
+			report.Issues = append(report.Issues, CheckIssue{
+				Key:     f.Key,
+				Field:   f.Path,
+				Type:    CheckMissing,
+				Message: "required key is missing",
+			})
+		}
+	}
+
+	// Decode into a new struct only if conversions will succeed
+	if report.OK() {
+		out := newStruct(t)
+
+		err := KVMapToStruct(in, prefix, out.Interface())
+		if errs, ok := err.(ValidationErrors); ok {
+			for _, e := range errs {
+				report.Issues = append(report.Issues, CheckIssue{
+					Key:     e.Key,
+					Field:   e.Field,
+					Type:    CheckInvalid,
+					Message: e.Message,
+				})
+			}
+		} else if err != nil {
+			report.Issues = append(report.Issues, CheckIssue{
+				Key:     prefix,
+				Type:    CheckMismatch,
+				Message: err.Error(),
+			})
+		}
+	}
+
+	report.sort()
+
+	return report
+}
+
+// OK returns true if no issue was found.
+func (r *CheckReport) OK() bool {
+	return len(r.Issues) == 0
+}
+
+// String implements fmt.Stringer by listing one issue per line.
+func (r *CheckReport) String() string {
+	var buf bytes.Buffer
+
+	for _, i := range r.Issues {
+		fmt.Fprintf(&buf, "%s %s: %s\n", i.Type, i.Key, i.Message)
+	}
+
+	return buf.String()
+}
+
+// sort sorts issues by key then by type.
+func (r *CheckReport) sort() {
+	sort.SliceStable(r.Issues, func(i, j int) bool {
+		if r.Issues[i].Key != r.Issues[j].Key {
+			return r.Issues[i].Key < r.Issues[j].Key
+		}
+		return r.Issues[i].Type < r.Issues[j].Type
+	})
+}
+
+// findField returns the field key belongs to.
+func findField(fields []structField, key string) (structField, bool) {
+	for _, f := range fields {
+		if f.matchKey(key) {
+			return f, true
+		}
+	}
+
+	return structField{}, false
+}
+
+// checkKind checks that the value at key can be converted to the type
+// of field f. It returns the failure message or an empty string.
+func checkKind(f structField, key string, v interface{}) string {
+	t := f.Field.Type
+	sensitive := f.Options.Has("sensitive") || f.Options.Has("secret")
+
+	switch t.Kind() {
+	case reflect.Map:
+		return ""
+	case reflect.Slice:
+		idx := strings.TrimPrefix(key, f.Key+"/")
+		if key == f.Key || strings.Contains(idx, "/") {
+			return fmt.Sprintf("field %s is a slice: elements must be stored at %s/<index>", f.Path, f.Key)
+		}
+
+		if _, err := strconv.Atoi(idx); err != nil {
+			return fmt.Sprintf("%s is not a slice index", idx)
+		}
+
+		t = t.Elem()
+	default:
+		if key != f.Key {
+			return fmt.Sprintf("field %s is neither a map nor a slice", f.Path)
+		}
+	}
+
+	var err error
+
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		_, err = cast.ToInt64E(v)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		_, err = cast.ToUint64E(v)
+	case reflect.Float32, reflect.Float64:
+		_, err = cast.ToFloat64E(v)
+	case reflect.Bool:
+		_, err = cast.ToBoolE(v)
+	}
+
+	if err != nil {
+		return fmt.Sprintf("value %q is not a valid %s", redact(cast.ToString(v), sensitive), t.Kind())
+	}
+
+	return ""
+}
+
+// newStruct allocates a new struct of struct type t with all its
+// pointers to substructs initialized, as KVMapToStruct requires.
+// It returns a pointer to the new struct.
+func newStruct(t reflect.Type) reflect.Value {
+	v := reflect.New(t)
+	initPointers(v.Elem())
+
+	return v
+}
+
+// initPointers initializes nil pointers to struct of struct value v.
+func initPointers(v reflect.Value) {
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Field(i)
+		if !f.CanSet() {
+			continue
+		}
+
+		switch {
+		case f.Kind() == reflect.Ptr && f.Type().Elem().Kind() == reflect.Struct:
+			if f.IsNil() {
+				f.Set(reflect.New(f.Type().Elem()))
+			}
+			initPointers(f.Elem())
+		case f.Kind() == reflect.Struct:
+			initPointers(f)
+		}
+	}
+}
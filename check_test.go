@@ -0,0 +1,180 @@
+package kvmapstruct
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	consul "github.com/hashicorp/consul/api"
+)
+
+func TestCheckKVMap(t *testing.T) {
+	type STChild struct {
+		Host string `validate:"nonempty"`
+		Port int    `validate:"port"`
+	}
+
+	type ST struct {
+		Name    string
+		Workers int
+		Debug   bool
+		Ports   []int
+		Labels  map[string]interface{}
+		DB      *STChild
+	}
+
+	testCases := []struct {
+		name   string
+		prefix string
+		input  map[string]interface{}
+		output []CheckIssue
+	}{
+		{
+			"ValidKVMap",
+			"test",
+			map[string]interface{}{
+				"test/Name":          "service",
+				"test/Workers":       "4",
+				"test/Debug":         "true",
+				"test/Ports/0":       "80",
+				"test/Labels/team/a": "b",
+				"test/DB/Host":       "localhost",
+				"test/DB/Port":       "5432",
+				"other/Name":         "other",
+			},
+			[]CheckIssue{},
+		},
+		{
+			"TypeMismatchUnknownAndMissing",
+			"test",
+			map[string]interface{}{
+				"test/Name":    "service",
+				"test/Workers": "four",
+				"test/Debug":   "maybe",
+				"test/Ports/a": "80",
+				"test/Name2":   "typo",
+				"test/DB/Port": "5432",
+			},
+			[]CheckIssue{
+				{Key: "test/DB/Host", Field: "DB.Host", Type: CheckMissing, Message: "required key is missing"},
+				{Key: "test/Debug", Field: "Debug", Type: CheckMismatch, Message: `value "maybe" is not a valid bool`},
+				{Key: "test/Name2", Type: CheckUnknown, Message: "key does not match any field"},
+				{Key: "test/Ports/a", Field: "Ports", Type: CheckMismatch, Message: "a is not a slice index"},
+				{Key: "test/Workers", Field: "Workers", Type: CheckMismatch, Message: `value "four" is not a valid int`},
+			},
+		},
+		{
+			"InvalidValue",
+			"test",
+			map[string]interface{}{
+				"test/DB/Host": "localhost",
+				"test/DB/Port": "70000",
+			},
+			[]CheckIssue{
+				{Key: "test/DB/Port", Field: "DB.Port", Type: CheckInvalid, Message: `value "70000" is not a port between 1 and 65535`},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			st := &ST{}
+
+			report := CheckKVMap(tc.input, tc.prefix, st)
+
+			if !reflect.DeepEqual(report.Issues, tc.output) {
+				t.Errorf("\nwant:\n%v\nhave:\n%v", tc.output, report.Issues)
+			}
+
+			// Output type must not be modified
+			if !reflect.DeepEqual(st, &ST{}) {
+				t.Errorf("output type modified: %v", st)
+			}
+		})
+	}
+
+}
+
+func TestCheck(t *testing.T) {
+	type ST struct {
+		Name    string
+		Workers int
+		Token   string `kv:",secret"`
+	}
+
+	testCases := []struct {
+		name   string
+		prefix string
+		stored map[string]interface{}
+		output []CheckIssue
+	}{
+		{
+			"ConsulIssues",
+			"test",
+			map[string]interface{}{
+				"test/":        "",
+				"test/Name":    "service",
+				"test/Workers": "four",
+				"test/Name2":   "typo",
+				"test/Token":   "clear text",
+				"test2/Name":   "other",
+			},
+			[]CheckIssue{
+				{Key: "test/Name2", Type: CheckUnknown, Message: "key does not match any field"},
+				{Key: "test/Token", Field: "Token", Type: CheckMismatch, Message: "cannot decrypt secret value: value is not encrypted"},
+				{Key: "test/Workers", Field: "Workers", Type: CheckMismatch, Message: `value "four" is not a valid int`},
+			},
+		},
+	}
+
+	kms, err := NewKVMapStruct("localhost:8500", "adf4238a-882b-9ddc-4a9d-5b6758e4159e", "test")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	dir, err := ioutil.TempDir("", "kvmapstruct")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "key")
+	err = ioutil.WriteFile(filename, []byte("0123456789abcdef0123456789abcdef"), 0600)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	kms.KeyProvider = NewKeyFileProvider(filename)
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			kms.Path = tc.prefix
+
+			// Insert data in to consul
+			for k, v := range tc.stored {
+				kv := &consul.KVPair{
+					Key:   k,
+					Value: []byte(v.(string)),
+				}
+
+				_, err := kms.Client.KV().Put(kv, nil)
+				if err != nil {
+					t.Errorf("%s", err)
+				}
+			}
+			defer kms.Client.KV().DeleteTree(tc.prefix, nil)
+
+			report, err := kms.Check(&ST{})
+			if err != nil {
+				t.Fatalf("%s", err)
+			}
+
+			if report.Path != tc.prefix || !reflect.DeepEqual(report.Issues, tc.output) {
+				t.Errorf("\nwant:\n%v\nhave:\n%v", tc.output, report.Issues)
+			}
+		})
+	}
+
+}
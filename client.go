@@ -0,0 +1,260 @@
+package kvmapstruct
+
+import (
+	"fmt"
+	"net/http"
+
+	consul "github.com/hashicorp/consul/api"
+)
+
+// ClientOption configures the Consul client of NewKVMapStructWithOptions.
+type ClientOption func(*clientOptions) error
+
+// clientOptions are the settings ClientOptions apply to.
+type clientOptions struct {
+	kms    *KVMapStruct
+	config *consul.Config
+	// client is an existing client set by WithClient
+	client *consul.Client
+	// transport is the HTTP transport set by WithTransport
+	transport *http.Transport
+	// tls is set by the options changing the TLS configuration
+	tls bool
+	// configured is set by the options changing config
+	configured bool
+}
+
+// NewKVMapStructWithOptions creates a new *KVMapStruct for path with a
+// Consul client configured by opts, applied in order on top of Consul's
+// default configuration, which reads the CONSUL_HTTP_* environment
+// variables.
+//
+//	kms, err := kvmapstruct.NewKVMapStructWithOptions("app",
+//		kvmapstruct.WithAddress("consul.service:8501"),
+//		kvmapstruct.WithCACert("/etc/consul/ca.pem"),
+//		kvmapstruct.WithClientCert("/etc/consul/client.pem", "/etc/consul/client-key.pem"),
+//	)
+func NewKVMapStructWithOptions(path string, opts ...ClientOption) (*KVMapStruct, error) {
+	o := &clientOptions{
+		kms:    &KVMapStruct{Path: path},
+		config: consul.DefaultConfig(),
+	}
+
+	for _, opt := range opts {
+		err := opt(o)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if o.client != nil {
+		if o.configured {
+			return nil, fmt.Errorf("Error: client configuration options can not be used with an existing client")
+		}
+
+		o.kms.Client = o.client
+
+		return o.kms, nil
+	}
+
+	// Consul only sets up TLS on transports with no TLS configuration
+	if o.transport != nil {
+		transport := o.transport.Clone()
+
+		if o.tls {
+			tlsConfig, err := consul.SetupTLSConfig(&o.config.TLSConfig)
+			if err != nil {
+				return nil, err
+			}
+
+			transport.TLSClientConfig = tlsConfig
+		}
+
+		o.config.Transport = transport
+	}
+
+	client, err := consul.NewClient(o.config)
+	if err != nil {
+		return nil, err
+	}
+
+	o.kms.Client = client
+
+	return o.kms, nil
+}
+
+// WithAddress sets the address of Consul, as host:port or as an URL
+// with the http, https or unix scheme.
+func WithAddress(address string) ClientOption {
+	return configOption(func(c *consul.Config) error {
+		c.Address = address
+		return nil
+	})
+}
+
+// WithToken sets the ACL token of the requests.
+func WithToken(token string) ClientOption {
+	return configOption(func(c *consul.Config) error {
+		c.Token = token
+		return nil
+	})
+}
+
+// WithScheme sets the scheme of the requests: http or https.
+func WithScheme(scheme string) ClientOption {
+	return configOption(func(c *consul.Config) error {
+		if scheme != "http" && scheme != "https" {
+			return fmt.Errorf("Error: scheme %s is neither http nor https", scheme)
+		}
+
+		c.Scheme = scheme
+		return nil
+	})
+}
+
+// WithDatacenter sets the datacenter of the requests.
+func WithDatacenter(datacenter string) ClientOption {
+	return configOption(func(c *consul.Config) error {
+		c.Datacenter = datacenter
+		return nil
+	})
+}
+
+// WithCACert verifies the certificate of Consul with the PEM encoded
+// CA certificates of caFile. The scheme is set to https.
+func WithCACert(caFile string) ClientOption {
+	return tlsOption(func(c *consul.Config) error {
+		c.TLSConfig.CAFile = caFile
+		c.Scheme = "https"
+		return nil
+	})
+}
+
+// WithCAPem verifies the certificate of Consul with the PEM encoded
+// CA certificates pem. The scheme is set to https.
+func WithCAPem(pem []byte) ClientOption {
+	return tlsOption(func(c *consul.Config) error {
+		c.TLSConfig.CAPem = pem
+		c.Scheme = "https"
+		return nil
+	})
+}
+
+// WithClientCert authenticates to Consul with the PEM encoded client
+// certificate certFile and its key keyFile, as required by Consul
+// agents with verify_incoming. The scheme is set to https.
+func WithClientCert(certFile, keyFile string) ClientOption {
+	return tlsOption(func(c *consul.Config) error {
+		if certFile == "" || keyFile == "" {
+			return fmt.Errorf("Error: client certificate requires both a certificate and a key")
+		}
+
+		c.TLSConfig.CertFile = certFile
+		c.TLSConfig.KeyFile = keyFile
+		c.Scheme = "https"
+		return nil
+	})
+}
+
+// WithTLSServerName sets the name the certificate of Consul is verified
+// against, when it differs from the host of the address.
+func WithTLSServerName(name string) ClientOption {
+	return tlsOption(func(c *consul.Config) error {
+		c.TLSConfig.Address = name
+		return nil
+	})
+}
+
+// WithInsecureSkipVerify disables the verification of the certificate
+// of Consul. It should only be used for testing.
+func WithInsecureSkipVerify() ClientOption {
+	return tlsOption(func(c *consul.Config) error {
+		c.TLSConfig.InsecureSkipVerify = true
+		c.Scheme = "https"
+		return nil
+	})
+}
+
+// WithBasicAuth authenticates the requests with HTTP basic authentication,
+// for Consul behind a reverse proxy for example.
+func WithBasicAuth(username, password string) ClientOption {
+	return configOption(func(c *consul.Config) error {
+		c.HttpAuth = &consul.HttpBasicAuth{
+			Username: username,
+			Password: password,
+		}
+		return nil
+	})
+}
+
+// WithTransport sets the HTTP transport of the client. The client uses
+// a clone of it: with TLS options, the TLS configuration of the clone
+// is replaced by the one of the options.
+func WithTransport(transport *http.Transport) ClientOption {
+	return func(o *clientOptions) error {
+		if transport == nil {
+			return fmt.Errorf("Error: transport is nil")
+		}
+
+		o.transport = transport
+		o.configured = true
+		return nil
+	}
+}
+
+// WithHTTPClient sets the HTTP client of the requests. TLS options
+// and WithTransport are ignored: the HTTP client is used as is.
+func WithHTTPClient(client *http.Client) ClientOption {
+	return configOption(func(c *consul.Config) error {
+		c.HttpClient = client
+		return nil
+	})
+}
+
+// WithClient uses an existing Consul client. It can not be combined
+// with the options configuring the client, but can with WithNamespace
+// and WithPartition.
+func WithClient(client *consul.Client) ClientOption {
+	return func(o *clientOptions) error {
+		if client == nil {
+			return fmt.Errorf("Error: client is nil")
+		}
+
+		o.client = client
+		return nil
+	}
+}
+
+// WithNamespace sets the Consul Enterprise namespace of all reads
+// and writes of kvmapstruct.
+func WithNamespace(namespace string) ClientOption {
+	return func(o *clientOptions) error {
+		o.kms.Namespace = namespace
+		return nil
+	}
+}
+
+// WithPartition sets the Consul Enterprise admin partition of all
+// reads and writes of kvmapstruct.
+func WithPartition(partition string) ClientOption {
+	return func(o *clientOptions) error {
+		o.kms.Partition = partition
+		return nil
+	}
+}
+
+// configOption returns a ClientOption changing the consul configuration.
+func configOption(f func(c *consul.Config) error) ClientOption {
+	return func(o *clientOptions) error {
+		o.configured = true
+		return f(o.config)
+	}
+}
+
+// tlsOption returns a ClientOption changing the TLS configuration.
+func tlsOption(f func(c *consul.Config) error) ClientOption {
+	return func(o *clientOptions) error {
+		o.tls = true
+		return configOption(f)(o)
+	}
+}
@@ -0,0 +1,211 @@
+package kvmapstruct
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	consul "github.com/hashicorp/consul/api"
+)
+
+// writeClientCert writes a self-signed client certificate and its key to dir.
+func writeClientCert(t *testing.T, dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "kvmapstruct"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	certFile := filepath.Join(dir, "client.pem")
+	keyFile := filepath.Join(dir, "client-key.pem")
+
+	err = ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	if err == nil {
+		err = ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	}
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	return certFile, keyFile
+}
+
+func TestNewKVMapStructWithOptions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kvmapstruct")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	certFile, keyFile := writeClientCert(t, dir)
+
+	// mTLS only Consul agent
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, _ := r.BasicAuth()
+
+		if len(r.TLS.PeerCertificates) == 0 || user != "user" || password != "pass" || r.Header.Get("X-Consul-Token") != "token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		w.Header().Set("X-Consul-Index", "42")
+		w.Header().Set("X-Consul-KnownLeader", "true")
+		w.Write([]byte(`[{"Key": "app/Env", "Value": "cHJvZA=="}]`))
+	}))
+	ts.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	ts.StartTLS()
+	defer ts.Close()
+
+	caPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})
+
+	// TLS options replace the TLS configuration of a clone of transport
+	tlsConfig := &tls.Config{}
+	transport := &http.Transport{TLSClientConfig: tlsConfig}
+
+	testCases := []struct {
+		name string
+		opts []ClientOption
+		err  bool
+	}{
+		{
+			"MutualTLS",
+			[]ClientOption{
+				WithAddress(ts.Listener.Addr().String()),
+				WithToken("token"),
+				WithCAPem(caPem),
+				WithClientCert(certFile, keyFile),
+				WithBasicAuth("user", "pass"),
+			},
+			false,
+		},
+		{
+			"NoClientCert",
+			[]ClientOption{
+				WithAddress(ts.Listener.Addr().String()),
+				WithToken("token"),
+				WithCAPem(caPem),
+				WithBasicAuth("user", "pass"),
+			},
+			true,
+		},
+		{
+			"TransportWithTLS",
+			[]ClientOption{
+				WithAddress(ts.Listener.Addr().String()),
+				WithToken("token"),
+				WithTransport(transport),
+				WithCAPem(caPem),
+				WithClientCert(certFile, keyFile),
+				WithBasicAuth("user", "pass"),
+			},
+			false,
+		},
+		{
+			"InsecureSkipVerify",
+			[]ClientOption{
+				WithAddress(ts.Listener.Addr().String()),
+				WithToken("token"),
+				WithInsecureSkipVerify(),
+				WithClientCert(certFile, keyFile),
+				WithBasicAuth("user", "pass"),
+			},
+			false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			kms, err := NewKVMapStructWithOptions("app", tc.opts...)
+			if err != nil {
+				t.Fatalf("%s", err)
+			}
+
+			m, meta, err := kms.ConsulKVToMapWithOptions(nil)
+			if tc.err {
+				if err == nil {
+					t.Fatalf("no error")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("%s", err)
+			}
+
+			if m["Env"] != "prod" || meta.LastIndex != 42 {
+				t.Errorf("wrong map %v or query meta %+v", m, meta)
+			}
+		})
+	}
+
+	if transport.TLSClientConfig != tlsConfig || len(tlsConfig.Certificates) != 0 || tlsConfig.RootCAs != nil {
+		t.Errorf("transport changed: %+v", transport.TLSClientConfig)
+	}
+
+}
+
+func TestClientOptionErrors(t *testing.T) {
+	client, err := consul.NewClient(consul.DefaultConfig())
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	kms, err := NewKVMapStructWithOptions("app", WithClient(client), WithNamespace("team"))
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if kms.Client != client || kms.Namespace != "team" {
+		t.Errorf("existing client or namespace not used")
+	}
+
+	testCases := []struct {
+		name string
+		opts []ClientOption
+	}{
+		{"ClientAndConfig", []ClientOption{WithClient(client), WithToken("token")}},
+		{"NilClient", []ClientOption{WithClient(nil)}},
+		{"NilTransport", []ClientOption{WithTransport(nil)}},
+		{"WrongScheme", []ClientOption{WithScheme("ftp")}},
+		{"CertWithoutKey", []ClientOption{WithClientCert("client.pem", "")}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewKVMapStructWithOptions("app", tc.opts...)
+			if err == nil {
+				t.Errorf("no error")
+			}
+		})
+	}
+
+}
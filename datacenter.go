@@ -0,0 +1,178 @@
+package kvmapstruct
+
+import (
+	"fmt"
+	"strings"
+
+	consul "github.com/hashicorp/consul/api"
+)
+
+// DatacenterResult is the result of a replicated write to a datacenter.
+type DatacenterResult struct {
+	// Datacenter is the datacenter written to
+	Datacenter string
+	// Keys is the number of keys written before Err, if any
+	Keys int
+	// Err is the error of the write to the datacenter
+	Err error
+}
+
+// ReplicationError is the error of a write replicated to Datacenters
+// that failed in at least one of them. Results contains the results
+// of all datacenters, in Datacenters order.
+type ReplicationError struct {
+	Results []DatacenterResult
+}
+
+// Error implements error.
+func (e *ReplicationError) Error() string {
+	var failed []string
+
+	for _, r := range e.Results {
+		if r.Err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %s", r.Datacenter, r.Err))
+		}
+	}
+
+	return fmt.Sprintf("write failed in %d of %d datacenters: %s", len(failed), len(e.Results), strings.Join(failed, "; "))
+}
+
+// Failed returns the datacenters the write failed in.
+func (e *ReplicationError) Failed() []string {
+	var dcs []string
+
+	for _, r := range e.Results {
+		if r.Err != nil {
+			dcs = append(dcs, r.Datacenter)
+		}
+	}
+
+	return dcs
+}
+
+// StructToConsulKVReplicated saves the struct as StructToConsulKV
+// does and returns the results of the writes to each of Datacenters,
+// in Datacenters order. If the write failed in a datacenter,
+// the error is a *ReplicationError with the same results.
+func (kms *KVMapStruct) StructToConsulKVReplicated(input interface{}) ([]DatacenterResult, error) {
+	if len(kms.Datacenters) == 0 {
+		return nil, fmt.Errorf("Error: no datacenter to replicate to")
+	}
+
+	pairs, err := kms.structToPairs(input)
+	if err != nil {
+		return nil, err
+	}
+
+	return kms.replicatePairs(pairs, nil)
+}
+
+// errNotReplicated returns the error of the operation op,
+// which can not be replicated to Datacenters.
+func errNotReplicated(op string) error {
+	return fmt.Errorf("%s is not replicated to datacenters: use a KVMapStruct per datacenter", op)
+}
+
+// putPairs writes consul kv pairs with write options w, to each
+// of Datacenters if set.
+func (kms *KVMapStruct) putPairs(pairs consul.KVPairs, w *consul.WriteOptions) error {
+	if len(kms.Datacenters) == 0 {
+		_, err := kms.putPairsTo(pairs, kms.writeOptions(w))
+		return err
+	}
+
+	_, err := kms.replicatePairs(pairs, w)
+
+	return err
+}
+
+// replicatePairs writes consul kv pairs with write options w to each
+// of Datacenters and returns the results. A failure in a datacenter
+// does not stop the writes to the next ones.
+func (kms *KVMapStruct) replicatePairs(pairs consul.KVPairs, w *consul.WriteOptions) ([]DatacenterResult, error) {
+	var results []DatacenterResult
+
+	failed := false
+
+	for _, dc := range kms.Datacenters {
+		opts := &consul.WriteOptions{}
+		if w != nil {
+			*opts = *w
+		}
+		opts.Datacenter = dc
+
+		n, err := kms.putPairsTo(pairs, kms.writeOptions(opts))
+		if err != nil {
+			failed = true
+		}
+
+		results = append(results, DatacenterResult{Datacenter: dc, Keys: n, Err: err})
+	}
+
+	if failed {
+		return results, &ReplicationError{Results: results}
+	}
+
+	return results, nil
+}
+
+// putPairsTo writes consul kv pairs with write options w and
+// returns the number of pairs written.
+func (kms *KVMapStruct) putPairsTo(pairs consul.KVPairs, w *consul.WriteOptions) (int, error) {
+	for i, kv := range pairs {
+		_, err := kms.Client.KV().Put(kv, w)
+		if err != nil {
+			return i, err
+		}
+	}
+
+	return len(pairs), nil
+}
+
+// queryOptions returns a copy of q with the namespace and partition
+// of kvmapstruct unless q sets them. Nil is returned unchanged if
+// kvmapstruct has neither namespace nor partition.
+func (kms *KVMapStruct) queryOptions(q *consul.QueryOptions) *consul.QueryOptions {
+	if kms.Namespace == "" && kms.Partition == "" {
+		return q
+	}
+
+	opts := &consul.QueryOptions{}
+	if q != nil {
+		*opts = *q
+	}
+
+	if opts.Namespace == "" {
+		opts.Namespace = kms.Namespace
+	}
+
+	if opts.Partition == "" {
+		opts.Partition = kms.Partition
+	}
+
+	return opts
+}
+
+// writeOptions returns a copy of w with the namespace and partition
+// of kvmapstruct unless w sets them. Nil is returned unchanged if
+// kvmapstruct has neither namespace nor partition.
+func (kms *KVMapStruct) writeOptions(w *consul.WriteOptions) *consul.WriteOptions {
+	if kms.Namespace == "" && kms.Partition == "" {
+		return w
+	}
+
+	opts := &consul.WriteOptions{}
+	if w != nil {
+		*opts = *w
+	}
+
+	if opts.Namespace == "" {
+		opts.Namespace = kms.Namespace
+	}
+
+	if opts.Partition == "" {
+		opts.Partition = kms.Partition
+	}
+
+	return opts
+}
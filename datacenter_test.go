@@ -0,0 +1,144 @@
+package kvmapstruct
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	consul "github.com/hashicorp/consul/api"
+)
+
+func TestReplicatedWrite(t *testing.T) {
+	type config struct {
+		Env     string
+		Workers int
+	}
+
+	kms, err := NewKVMapStruct("localhost:8500", "adf4238a-882b-9ddc-4a9d-5b6758e4159e", "replicated")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	in := config{Env: "prod", Workers: 4}
+
+	_, err = kms.StructToConsulKVReplicated(in)
+	if err == nil {
+		t.Fatalf("no error without datacenters")
+	}
+
+	kms.Datacenters = []string{"dc1"}
+
+	err = kms.StructToConsulKV(in)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	results, err := kms.StructToConsulKVReplicated(in)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	want := []DatacenterResult{{Datacenter: "dc1", Keys: 2}}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("\nwant:\n%+v\nhave:\n%+v", want, results)
+	}
+
+	// The dev agent only knows its own datacenter
+	kms.Datacenters = []string{"dc1", "unknown"}
+
+	err = kms.StructToConsulKV(in)
+
+	var e *ReplicationError
+	if !errors.As(err, &e) {
+		t.Fatalf("wrong error: %v", err)
+	}
+
+	if e.Results[0].Err != nil || e.Results[0].Keys != 2 {
+		t.Errorf("wrong result of dc1: %+v", e.Results[0])
+	}
+
+	if !reflect.DeepEqual(e.Failed(), []string{"unknown"}) {
+		t.Errorf("wrong failed datacenters: %v", e.Failed())
+	}
+
+	results, err = kms.StructToConsulKVReplicated(in)
+	if !errors.As(err, &e) || !reflect.DeepEqual(results, e.Results) {
+		t.Errorf("wrong results %+v with error %v", results, err)
+	}
+
+	// Plans and restores are not replicated
+	_, err = kms.Plan(in)
+	if err == nil {
+		t.Errorf("plan with datacenters")
+	}
+
+	err = kms.Apply(&Plan{Path: "replicated"})
+	if err == nil {
+		t.Errorf("apply with datacenters")
+	}
+
+	err = kms.Restore(&Snapshot{Version: SnapshotVersion, Path: "replicated"})
+	if err == nil {
+		t.Errorf("restore with datacenters")
+	}
+
+	out := &config{}
+
+	err = kms.ConsulKVToStruct(out)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if !reflect.DeepEqual(*out, in) {
+		t.Errorf("\nwant:\n%v\nhave:\n%v", in, *out)
+	}
+
+}
+
+func TestNamespaceOptions(t *testing.T) {
+	testCases := []struct {
+		name   string
+		kms    *KVMapStruct
+		input  *consul.QueryOptions
+		output *consul.QueryOptions
+	}{
+		{
+			"NoNamespace",
+			&KVMapStruct{},
+			nil,
+			nil,
+		},
+		{
+			"KVMapStructNamespace",
+			&KVMapStruct{Namespace: "team", Partition: "apps"},
+			nil,
+			&consul.QueryOptions{Namespace: "team", Partition: "apps"},
+		},
+		{
+			"QueryNamespace",
+			&KVMapStruct{Namespace: "team", Partition: "apps"},
+			&consul.QueryOptions{Namespace: "other", Datacenter: "dc2"},
+			&consul.QueryOptions{Namespace: "other", Partition: "apps", Datacenter: "dc2"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := tc.kms.queryOptions(tc.input)
+			if !reflect.DeepEqual(q, tc.output) {
+				t.Errorf("\nwant:\n%+v\nhave:\n%+v", tc.output, q)
+			}
+
+			var in *consul.WriteOptions
+			if tc.input != nil {
+				in = &consul.WriteOptions{Namespace: tc.input.Namespace, Datacenter: tc.input.Datacenter}
+			}
+
+			w := tc.kms.writeOptions(in)
+			if (w == nil) != (q == nil) || (w != nil && (w.Namespace != q.Namespace || w.Partition != q.Partition)) {
+				t.Errorf("write options %+v do not match query options %+v", w, q)
+			}
+		})
+	}
+
+}
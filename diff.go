@@ -0,0 +1,195 @@
+package kvmapstruct
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	consul "github.com/hashicorp/consul/api"
+)
+
+// DiffType is the kind of change of a key between Consul and an input.
+type DiffType string
+
+const (
+	// DiffAdded means the key only exists in the input.
+	DiffAdded DiffType = "added"
+	// DiffModified means the key exists in both but with different values.
+	DiffModified DiffType = "modified"
+	// DiffRemoved means the key only exists in Consul.
+	DiffRemoved DiffType = "removed"
+)
+
+// DiffEntry describes the change of a single Consul key.
+// Old is empty for added keys and New is empty for removed keys.
+// Values of sensitive entries are replaced by Redacted when rendered,
+// printed or marshaled to JSON.
+type DiffEntry struct {
+	Key       string   `json:"key"`
+	Type      DiffType `json:"type"`
+	Old       string   `json:"old,omitempty"`
+	New       string   `json:"new,omitempty"`
+	Sensitive bool     `json:"sensitive,omitempty"`
+}
+
+// diffEntry has the same fields as DiffEntry without its methods.
+type diffEntry DiffEntry
+
+// KVDiff contains the changes between Consul and an input, sorted by key.
+type KVDiff struct {
+	Path    string      `json:"path"`
+	Entries []DiffEntry `json:"entries"`
+}
+
+// Diff compares the kv pairs the input would be converted to
+// with the kv pairs currently stored under kvmapstruct path.
+// input argument can be a Go struct, a pointer to a Go struct
+// or a map[string]interface{}. Nothing is written to Consul.
+// Secret fields are compared in clear text and, like the fields
+// tagged with `kv:",sensitive"`, are marked as sensitive.
+func (kms *KVMapStruct) Diff(input interface{}) (*KVDiff, error) {
+	desired, secrets, err := kms.inputToKVPairs(input)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := kms.listKVPairs()
+	if err != nil {
+		return nil, err
+	}
+
+	err = kms.decryptPairs(current, secrets)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := DiffKVPairs(current, desired)
+	diff.Path = kms.Path
+
+	sensitives := sensitiveFields(reflect.TypeOf(input), kms.Path)
+	for i, e := range diff.Entries {
+		diff.Entries[i].Sensitive = matchFields(sensitives, e.Key)
+	}
+
+	return diff, nil
+}
+
+// DiffKVPairs compares two lists of Consul kv pairs.
+// current is the actual state and desired is the wanted one.
+func DiffKVPairs(current, desired consul.KVPairs) *KVDiff {
+	diff := &KVDiff{
+		Entries: []DiffEntry{},
+	}
+
+	cur := make(map[string]string)
+	for _, kv := range current {
+		cur[kv.Key] = string(kv.Value)
+	}
+
+	want := make(map[string]string)
+	for _, kv := range desired {
+		want[kv.Key] = string(kv.Value)
+	}
+
+	for k, v := range want {
+		o, ok := cur[k]
+		if !ok {
+			diff.Entries = append(diff.Entries, DiffEntry{Key: k, Type: DiffAdded, New: v})
+		} else if o != v {
+			diff.Entries = append(diff.Entries, DiffEntry{Key: k, Type: DiffModified, Old: o, New: v})
+		}
+	}
+
+	for k, o := range cur {
+		if _, ok := want[k]; !ok {
+			diff.Entries = append(diff.Entries, DiffEntry{Key: k, Type: DiffRemoved, Old: o})
+		}
+	}
+
+	sort.Slice(diff.Entries, func(i, j int) bool {
+		return diff.Entries[i].Key < diff.Entries[j].Key
+	})
+
+	return diff
+}
+
+// Empty returns true if there is no change.
+func (d *KVDiff) Empty() bool {
+	return len(d.Entries) == 0
+}
+
+// Unified renders the changes as a unified text diff.
+// Consul state is the original side and the input is the new side.
+func (d *KVDiff) Unified() string {
+	var buf bytes.Buffer
+
+	if d.Empty() {
+		return ""
+	}
+
+	fmt.Fprintf(&buf, "--- consul/%s\n", d.Path)
+	fmt.Fprintf(&buf, "+++ input/%s\n", d.Path)
+
+	for _, e := range d.Entries {
+		o := redact(e.Old, e.Sensitive)
+		n := redact(e.New, e.Sensitive)
+
+		switch e.Type {
+		case DiffAdded:
+			fmt.Fprintf(&buf, "+%s = %s\n", e.Key, n)
+		case DiffModified:
+			fmt.Fprintf(&buf, "-%s = %s\n", e.Key, o)
+			fmt.Fprintf(&buf, "+%s = %s\n", e.Key, n)
+		case DiffRemoved:
+			fmt.Fprintf(&buf, "-%s = %s\n", e.Key, o)
+		}
+	}
+
+	return buf.String()
+}
+
+// String implements fmt.Stringer by rendering a unified text diff.
+func (d *KVDiff) String() string {
+	return d.Unified()
+}
+
+// MarshalJSON implements json.Marshaler by redacting sensitive values.
+func (e DiffEntry) MarshalJSON() ([]byte, error) {
+	return json.Marshal(e.redacted())
+}
+
+// String implements fmt.Stringer by redacting sensitive values.
+func (e DiffEntry) String() string {
+	return fmt.Sprintf("%v", e.redacted())
+}
+
+// GoString implements fmt.GoStringer by redacting sensitive values.
+func (e DiffEntry) GoString() string {
+	r := e.redacted()
+
+	return fmt.Sprintf("kvmapstruct.DiffEntry{Key:%q, Type:%q, Old:%q, New:%q, Sensitive:%t}", r.Key, r.Type, r.Old, r.New, r.Sensitive)
+}
+
+// redacted returns the fields of the entry with sensitive values redacted.
+func (e DiffEntry) redacted() diffEntry {
+	entry := diffEntry(e)
+
+	if e.Sensitive {
+		if entry.Old != "" {
+			entry.Old = Redacted
+		}
+		if entry.New != "" {
+			entry.New = Redacted
+		}
+	}
+
+	return entry
+}
+
+// JSON renders the changes as an indented JSON document.
+// Sensitive values are redacted.
+func (d *KVDiff) JSON() ([]byte, error) {
+	return json.MarshalIndent(d, "", "  ")
+}
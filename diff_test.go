@@ -0,0 +1,158 @@
+package kvmapstruct
+
+import (
+	"reflect"
+	"testing"
+
+	consul "github.com/hashicorp/consul/api"
+)
+
+func TestDiffKVPairs(t *testing.T) {
+	testCases := []struct {
+		name    string
+		current consul.KVPairs
+		desired consul.KVPairs
+		output  []DiffEntry
+		unified string
+	}{
+		{
+			"NoChange",
+			consul.KVPairs{
+				{Key: "test/key1", Value: []byte("val1")},
+			},
+			consul.KVPairs{
+				{Key: "test/key1", Value: []byte("val1")},
+			},
+			[]DiffEntry{},
+			"",
+		},
+		{
+			"AddedModifiedRemoved",
+			consul.KVPairs{
+				{Key: "test/key1", Value: []byte("val1")},
+				{Key: "test/key2", Value: []byte("1")},
+				{Key: "test/key3/0", Value: []byte("one")},
+			},
+			consul.KVPairs{
+				{Key: "test/key1", Value: []byte("val1")},
+				{Key: "test/key2", Value: []byte("2")},
+				{Key: "test/key4", Value: []byte("val4")},
+			},
+			[]DiffEntry{
+				{Key: "test/key2", Type: DiffModified, Old: "1", New: "2"},
+				{Key: "test/key3/0", Type: DiffRemoved, Old: "one"},
+				{Key: "test/key4", Type: DiffAdded, New: "val4"},
+			},
+			"--- consul/test\n" +
+				"+++ input/test\n" +
+				"-test/key2 = 1\n" +
+				"+test/key2 = 2\n" +
+				"-test/key3/0 = one\n" +
+				"+test/key4 = val4\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			diff := DiffKVPairs(tc.current, tc.desired)
+			diff.Path = "test"
+
+			if !reflect.DeepEqual(diff.Entries, tc.output) {
+				t.Errorf("\nwant:\n%v\nhave:\n%v", tc.output, diff.Entries)
+			}
+
+			if diff.Unified() != tc.unified {
+				t.Errorf("\nwant:\n%s\nhave:\n%s", tc.unified, diff.Unified())
+			}
+		})
+	}
+
+}
+
+func TestDiff(t *testing.T) {
+	type ST struct {
+		Key1 string
+		Key2 int
+		Key3 []int
+	}
+
+	testCases := []struct {
+		name   string
+		prefix string
+		stored map[string]interface{}
+		input  interface{}
+		output []DiffEntry
+	}{
+		{
+			"StructAgainstConsul",
+			"test",
+			map[string]interface{}{
+				"test/Key1":   "val1",
+				"test/Key2":   "1",
+				"test/Key3/0": "1",
+				"test/Key3/1": "2",
+				"test/Key5":   "val5",
+			},
+			ST{
+				Key1: "val1",
+				Key2: 2,
+				Key3: []int{1, 2, 3},
+			},
+			[]DiffEntry{
+				{Key: "test/Key2", Type: DiffModified, Old: "1", New: "2"},
+				{Key: "test/Key3/2", Type: DiffAdded, New: "3"},
+				{Key: "test/Key5", Type: DiffRemoved, Old: "val5"},
+			},
+		},
+		{
+			"MapAgainstConsul",
+			"test",
+			map[string]interface{}{
+				"test/key1": "val1",
+			},
+			map[string]interface{}{
+				"key1": "val1",
+				"key2": map[string]interface{}{
+					"key21": "val21",
+				},
+			},
+			[]DiffEntry{
+				{Key: "test/key2/key21", Type: DiffAdded, New: "val21"},
+			},
+		},
+	}
+
+	kms, err := NewKVMapStruct("localhost:8500", "adf4238a-882b-9ddc-4a9d-5b6758e4159e", "test")
+	if err != nil {
+		t.Errorf("%s", err.Error())
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			kms.Path = tc.prefix
+
+			// Insert data in to consul
+			for k, v := range tc.stored {
+				kv := &consul.KVPair{
+					Key:   k,
+					Value: []byte(v.(string)),
+				}
+
+				_, err := kms.Client.KV().Put(kv, nil)
+				if err != nil {
+					t.Errorf("%s", err)
+				}
+			}
+
+			diff, err := kms.Diff(tc.input)
+			if err != nil {
+				t.Errorf("%s", err)
+			} else if !reflect.DeepEqual(diff.Entries, tc.output) {
+				t.Errorf("\nwant:\n%v\nhave:\n%v", tc.output, diff.Entries)
+			}
+
+			kms.Client.KV().DeleteTree(tc.prefix, nil)
+		})
+	}
+
+}
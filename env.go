@@ -0,0 +1,166 @@
+package kvmapstruct
+
+import (
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// DefaultEnvSeparator separates key path segments in environment variable names.
+const DefaultEnvSeparator = "__"
+
+// EnvOverlay overrides kv pairs with process environment variables.
+// With prefix APP_ and separator __, APP_DB__HOST sets the key DB/Host
+// of a Go struct and APP_HOSTS=a,b replaces the whole slice Hosts,
+// APP_HOSTS= empties it.
+// APP_LABELS__TEAM sets the key TEAM of the map Labels. Names are
+// matched to struct fields case insensitively, variables matching
+// no field are ignored.
+type EnvOverlay struct {
+	// Prefix is the prefix of the environment variables to use
+	Prefix string
+	// Separator separates key path segments in variable names
+	Separator string
+}
+
+// NewEnvOverlay creates a new *EnvOverlay.
+// If separator is empty, DefaultEnvSeparator is used.
+func NewEnvOverlay(prefix, separator string) *EnvOverlay {
+	if separator == "" {
+		separator = DefaultEnvSeparator
+	}
+
+	return &EnvOverlay{
+		Prefix:    prefix,
+		Separator: separator,
+	}
+}
+
+// Overlay returns a copy of the KV map in with the values of the
+// environment variables matching the fields of the Go struct st
+// set at their keys under prefix. st argument can be a Go struct
+// or a pointer to a Go struct, initialized or not.
+func (e *EnvOverlay) Overlay(in map[string]interface{}, prefix string, st interface{}) map[string]interface{} {
+	return overlayLayer(in, prefix, st, e.Layer(st))
+}
+
+// Layer returns the environment variables matching the fields of
+// the Go struct st as a layer for LayersToStruct. Sources of its keys
+// are the variable names.
+func (e *EnvOverlay) Layer(st interface{}) Layer {
+	l := Layer{
+		Name:    "env",
+		KVMap:   make(map[string]interface{}),
+		origins: make(map[string]string),
+		kind:    SourceEnv,
+	}
+
+	for k, ev := range e.lookup(st) {
+		if !ev.list {
+			l.KVMap[k] = ev.value
+			l.origins[k] = ev.name
+			continue
+		}
+
+		// An empty value redefines the slice with no element
+		elems := splitList(ev.value)
+		if len(elems) == 0 {
+			if l.empty == nil {
+				l.empty = make(map[string]bool)
+			}
+
+			l.empty[k] = true
+		}
+
+		for j, elem := range elems {
+			ek := k + "/" + strconv.Itoa(j)
+			l.KVMap[ek] = elem
+			l.origins[ek] = ev.name
+		}
+	}
+
+	return l
+}
+
+// envVar is an environment variable matching a struct field.
+type envVar struct {
+	name  string
+	value string
+	// list is set if the field is a slice: value contains
+	// comma separated elements, as flags
+	list bool
+}
+
+// lookup returns the environment variables matching the fields
+// of st by relative key.
+func (e *EnvOverlay) lookup(st interface{}) map[string]envVar {
+	vars := make(map[string]envVar)
+	fields := structFields(reflect.TypeOf(st), "")
+
+	separator := e.Separator
+	if separator == "" {
+		separator = DefaultEnvSeparator
+	}
+
+	for _, env := range os.Environ() {
+		i := strings.Index(env, "=")
+		if i < 0 || !strings.HasPrefix(env[:i], e.Prefix) {
+			continue
+		}
+
+		name := env[:i]
+		value := env[i+1:]
+		segments := strings.Split(strings.TrimPrefix(name, e.Prefix), separator)
+
+		for _, f := range fields {
+			key, ok := matchEnvSegments(f, segments)
+			if !ok {
+				continue
+			}
+
+			vars[key] = envVar{
+				name:  name,
+				value: value,
+				list:  f.Field.Type.Kind() == reflect.Slice,
+			}
+
+			break
+		}
+	}
+
+	return vars
+}
+
+// matchEnvSegments checks if the segments of an environment variable
+// name match the field f. It returns the relative key the variable sets.
+func matchEnvSegments(f structField, segments []string) (string, bool) {
+	parts := strings.Split(f.Key, "/")
+
+	if len(segments) < len(parts) {
+		return "", false
+	}
+
+	for i, p := range parts {
+		if !strings.EqualFold(p, segments[i]) {
+			return "", false
+		}
+	}
+
+	rest := segments[len(parts):]
+
+	// Only maps have keys under the field key
+	if f.Field.Type.Kind() == reflect.Map {
+		if len(rest) == 0 {
+			return "", false
+		}
+
+		return f.Key + "/" + strings.Join(rest, "/"), true
+	}
+
+	if len(rest) > 0 {
+		return "", false
+	}
+
+	return f.Key, true
+}
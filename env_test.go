@@ -0,0 +1,150 @@
+package kvmapstruct
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestEnvOverlay(t *testing.T) {
+	type STChild struct {
+		Host string
+		Port int
+	}
+
+	type ST struct {
+		Env     string
+		Hosts   []string
+		Ports   []int
+		Labels  map[string]interface{}
+		DB      *STChild
+		Workers int
+	}
+
+	testCases := []struct {
+		name      string
+		prefix    string
+		separator string
+		env       map[string]string
+		input     map[string]interface{}
+		output    map[string]interface{}
+	}{
+		{
+			"DefaultSeparator",
+			"APP_",
+			"",
+			map[string]string{
+				"APP_DB__HOST":     "db.prod",
+				"APP_ENV":          "prod",
+				"APP_HOSTS":        "host1,host2",
+				"APP_PORTS__1":     "8081",
+				"APP_LABELS__team": "core",
+				"APP_UNKNOWN":      "ignored",
+				"OTHER_ENV":        "ignored",
+			},
+			map[string]interface{}{
+				"test/Env":     "dev",
+				"test/Hosts/0": "local1",
+				"test/Hosts/1": "local2",
+				"test/Hosts/2": "local3",
+				"test/Ports/0": "8080",
+				"test/Ports/1": "8080",
+				"test/DB/Host": "localhost",
+				"test/Workers": "2",
+			},
+			map[string]interface{}{
+				"test/Env":         "prod",
+				"test/Hosts/0":     "host1",
+				"test/Hosts/1":     "host2",
+				"test/Ports/0":     "8080",
+				"test/Ports/1":     "8080",
+				"test/Labels/team": "core",
+				"test/DB/Host":     "db.prod",
+				"test/Workers":     "2",
+			},
+		},
+		{
+			"CustomSeparator",
+			"SVC_",
+			"_",
+			map[string]string{
+				"SVC_DB_PORT": "5433",
+			},
+			map[string]interface{}{
+				"test/DB/Port": "5432",
+			},
+			map[string]interface{}{
+				"test/DB/Port": "5433",
+			},
+		},
+		{
+			"EmptyList",
+			"CFG_",
+			"",
+			map[string]string{
+				"CFG_HOSTS": "",
+			},
+			map[string]interface{}{
+				"test/Env":     "dev",
+				"test/Hosts/0": "host1",
+				"test/Hosts/1": "host2",
+			},
+			map[string]interface{}{
+				"test/Env": "dev",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			for k, v := range tc.env {
+				os.Setenv(k, v)
+				defer os.Unsetenv(k)
+			}
+
+			e := NewEnvOverlay(tc.prefix, tc.separator)
+			o := e.Overlay(tc.input, "test", &ST{})
+
+			if !reflect.DeepEqual(o, tc.output) {
+				t.Errorf("\nwant:\n%v\nhave:\n%v", tc.output, o)
+			}
+		})
+	}
+
+}
+
+func TestEnvOverlayLayer(t *testing.T) {
+	type ST struct {
+		Env     string
+		Workers int
+	}
+
+	os.Setenv("APP_WORKERS", "8")
+	defer os.Unsetenv("APP_WORKERS")
+
+	st := &ST{}
+	layers := []Layer{
+		MapLayer("global", map[string]interface{}{
+			"config/Env":     "dev",
+			"config/Workers": "1",
+		}, "config"),
+		NewEnvOverlay("APP_", "").Layer(st),
+	}
+
+	m, sources := MergeLayers(layers, st)
+
+	err := KVMapToStruct(m, "", st)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if !reflect.DeepEqual(st, &ST{Env: "dev", Workers: 8}) {
+		t.Errorf("\nwant:\n%v\nhave:\n%v", &ST{Env: "dev", Workers: 8}, st)
+	}
+
+	want := Source{Layer: "env", Kind: SourceEnv, Key: "APP_WORKERS"}
+	if sources["Workers"] != want {
+		t.Errorf("\nwant:\n%v\nhave:\n%v", want, sources["Workers"])
+	}
+
+}
@@ -0,0 +1,155 @@
+// Package etcdstore implements kvmapstruct.Store and kvmapstruct.Watcher
+// with etcd v3, so that Go structs can be loaded, saved and watched
+// under etcd prefixes with kvmapstruct.Load, Save and Watch:
+//
+//	store, err := etcdstore.New([]string{"localhost:2379"})
+//	err = kvmapstruct.Save(ctx, store, "config/app", cfg)
+//	cfg, err := kvmapstruct.Load[Config](ctx, store, "config/app")
+//
+// Keys are "/" separated paths as in Consul. Indexes are etcd revisions.
+package etcdstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/cast"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	"github.com/uthng/kvmapstruct/internal/kvpath"
+)
+
+// DefaultMaxTxnOps is the default maximum number of operations
+// of an etcd transaction, the --max-txn-ops flag of etcd servers.
+const DefaultMaxTxnOps = 128
+
+// Store contains etcd informations.
+type Store struct {
+	// Client is etcd client
+	Client *clientv3.Client
+	// MaxTxnOps is the maximum number of kv pairs of a Put. It must
+	// not exceed the --max-txn-ops limit of the etcd servers.
+	MaxTxnOps int
+}
+
+// New creates a new *Store connected to etcd endpoints.
+// Endpoints format is ip:port.
+func New(endpoints []string) (*Store, error) {
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   endpoints,
+		DialTimeout: 5 * time.Second,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return NewFromClient(client), nil
+}
+
+// NewFromClient creates a new *Store with an existing etcd client.
+func NewFromClient(client *clientv3.Client) *Store {
+	return &Store{
+		Client:    client,
+		MaxTxnOps: DefaultMaxTxnOps,
+	}
+}
+
+// Close closes the etcd client.
+func (s *Store) Close() error {
+	return s.Client.Close()
+}
+
+// List implements kvmapstruct.Store with a range request on prefix.
+func (s *Store) List(ctx context.Context, prefix string) (map[string]interface{}, error) {
+	m, _, err := s.list(ctx, prefix)
+
+	return m, err
+}
+
+// Put implements kvmapstruct.Store. All kv pairs are written in a
+// single transaction: either all of them are saved or none. KV maps
+// of more than MaxTxnOps kv pairs are rejected without writing anything.
+func (s *Store) Put(ctx context.Context, kvmap map[string]interface{}) error {
+	var ops []clientv3.Op
+
+	limit := s.MaxTxnOps
+	if limit <= 0 {
+		limit = DefaultMaxTxnOps
+	}
+
+	if len(kvmap) > limit {
+		return fmt.Errorf("%d kv pairs exceed the %d operations of an etcd transaction", len(kvmap), limit)
+	}
+
+	for k, v := range kvmap {
+		ops = append(ops, clientv3.OpPut(k, cast.ToString(v)))
+	}
+
+	_, err := s.Client.Txn(ctx).Then(ops...).Commit()
+
+	return err
+}
+
+// Watch implements kvmapstruct.Watcher. It blocks until a key under
+// prefix changes after revision index, or ctx is done. If revision
+// index was compacted, the keys under prefix are listed again at
+// the current revision.
+func (s *Store) Watch(ctx context.Context, prefix string, index uint64) (map[string]interface{}, uint64, error) {
+	if index == 0 {
+		return s.list(ctx, prefix)
+	}
+
+	wctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	wch := s.Client.Watch(wctx, prefix, clientv3.WithPrefix(), clientv3.WithRev(int64(index)+1))
+
+	for resp := range wch {
+		err := resp.Err()
+		if errors.Is(err, rpctypes.ErrCompacted) {
+			return s.list(ctx, prefix)
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+
+		// WithPrefix also watches siblings, app2/Env for app
+		for _, ev := range resp.Events {
+			if kvpath.InPath(string(ev.Kv.Key), prefix) {
+				return s.list(ctx, prefix)
+			}
+		}
+	}
+
+	if ctx.Err() != nil {
+		return nil, 0, ctx.Err()
+	}
+
+	return nil, 0, fmt.Errorf("watch of %s closed", prefix)
+}
+
+// list gets all kv pairs under prefix as a KV map with the revision
+// of the store.
+func (s *Store) list(ctx context.Context, prefix string) (map[string]interface{}, uint64, error) {
+	m := make(map[string]interface{})
+
+	resp, err := s.Client.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, 0, err
+	}
+
+	for _, kv := range resp.Kvs {
+		k := string(kv.Key)
+		if strings.HasSuffix(k, "/") || !kvpath.InPath(k, prefix) {
+			continue
+		}
+
+		m[k] = string(kv.Value)
+	}
+
+	return m, uint64(resp.Header.Revision), nil
+}
@@ -0,0 +1,163 @@
+package etcdstore
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"go.etcd.io/etcd/server/v3/embed"
+
+	"github.com/uthng/kvmapstruct/internal/storetest"
+)
+
+// startEtcd starts an embedded etcd server and returns a store connected to it.
+func startEtcd(t *testing.T) (*Store, func()) {
+	dir, err := ioutil.TempDir("", "etcdstore")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	cfg := embed.NewConfig()
+	cfg.Dir = dir
+	cfg.LogLevel = "error"
+	cfg.ListenClientUrls = []url.URL{freeURL(t)}
+	cfg.AdvertiseClientUrls = cfg.ListenClientUrls
+	cfg.ListenPeerUrls = []url.URL{freeURL(t)}
+	cfg.AdvertisePeerUrls = cfg.ListenPeerUrls
+	cfg.InitialCluster = cfg.InitialClusterFromName(cfg.Name)
+
+	e, err := embed.StartEtcd(cfg)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("%s", err)
+	}
+
+	select {
+	case <-e.Server.ReadyNotify():
+	case <-time.After(10 * time.Second):
+		e.Close()
+		os.RemoveAll(dir)
+		t.Fatalf("etcd server not ready")
+	}
+
+	store, err := New([]string{cfg.ListenClientUrls[0].Host})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	return store, func() {
+		store.Close()
+		e.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// freeURL returns an URL on a free local port.
+func freeURL(t *testing.T) url.URL {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer l.Close()
+
+	return url.URL{Scheme: "http", Host: l.Addr().String()}
+}
+
+func TestStore(t *testing.T) {
+	store, stop := startEtcd(t)
+	defer stop()
+
+	storetest.Run(t, store, "test")
+
+}
+
+func TestStorePutTxnLimit(t *testing.T) {
+	ctx := context.Background()
+
+	store, stop := startEtcd(t)
+	defer stop()
+
+	in := make(map[string]interface{})
+	for i := 0; i < DefaultMaxTxnOps; i++ {
+		in[fmt.Sprintf("test/key%d", i)] = i
+	}
+
+	err := store.Put(ctx, in)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	// Oversize saves are rejected as a whole
+	in["test/key128"] = 128
+
+	err = store.Put(ctx, in)
+	if err == nil {
+		t.Fatalf("no error")
+	}
+
+	m, err := store.List(ctx, "test")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if len(m) != DefaultMaxTxnOps {
+		t.Errorf("want %d keys, have %d", DefaultMaxTxnOps, len(m))
+	}
+
+}
+
+func TestStoreWatchCompacted(t *testing.T) {
+	ctx := context.Background()
+
+	store, stop := startEtcd(t)
+	defer stop()
+
+	err := store.Put(ctx, map[string]interface{}{"test/Env": "dev"})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	_, index, err := store.Watch(ctx, "test", 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	err = store.Put(ctx, map[string]interface{}{"test/Env": "prod"})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	resp, err := store.Client.Put(ctx, "other", "x")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	_, err = store.Client.Compact(ctx, resp.Header.Revision)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	// Revisions after index were compacted: keys are listed again
+	m, i, err := store.Watch(ctx, "test", index)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if m["test/Env"] != "prod" || i != uint64(resp.Header.Revision) {
+		t.Errorf("wrong keys %v at revision %d", m, i)
+	}
+
+}
+
+func TestStoreWatch(t *testing.T) {
+	store, stop := startEtcd(t)
+	defer stop()
+
+	storetest.RunWatch(t, store, "test")
+
+}
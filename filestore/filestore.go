@@ -0,0 +1,273 @@
+// Package filestore implements kvmapstruct.Store and kvmapstruct.Watcher
+// with a local directory tree: one file per key and one directory per
+// path segment, as in Kubernetes ConfigMap volumes or git2consul
+// repositories. The key app/DB/Host is the content of the file
+// app/DB/Host under the root directory.
+//
+//	store := filestore.New("/etc/config")
+//	cfg, err := kvmapstruct.Load[Config](ctx, store, "app")
+//
+// Files and directories whose name starts with a dot are ignored, such
+// as ..data and timestamped directories of ConfigMap volumes or .git.
+// Symbolic links are followed.
+package filestore
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cast"
+)
+
+// DefaultPollInterval is the default interval between two reads of
+// the directory tree by Watch.
+const DefaultPollInterval = 2 * time.Second
+
+// Store contains the directory tree informations.
+type Store struct {
+	// Dir is the root directory of the keys
+	Dir string
+	// Perm is the permission of files written by Put
+	Perm os.FileMode
+	// TrimNewline removes a trailing newline from file contents,
+	// as added by most text editors
+	TrimNewline bool
+	// PollInterval is the interval between two reads of the
+	// directory tree by Watch
+	PollInterval time.Duration
+}
+
+// New creates a new *Store rooted at dir.
+func New(dir string) *Store {
+	return &Store{
+		Dir:          dir,
+		Perm:         0644,
+		PollInterval: DefaultPollInterval,
+	}
+}
+
+// List implements kvmapstruct.Store. The prefix can be a directory or a file.
+// Prefixes are checked as keys of Put, so that List never reads outside Dir.
+func (s *Store) List(ctx context.Context, prefix string) (map[string]interface{}, error) {
+	m := make(map[string]interface{})
+	prefix = strings.Trim(prefix, "/")
+
+	if prefix != "" && !validKey(prefix) {
+		return nil, fmt.Errorf("invalid prefix %q", prefix)
+	}
+
+	info, err := os.Stat(s.path(prefix))
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		v, err := s.read(prefix)
+		if err != nil {
+			return nil, err
+		}
+
+		m[prefix] = v
+
+		return m, nil
+	}
+
+	err = s.walk(prefix, m)
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// Put implements kvmapstruct.Store. Missing directories are created and
+// files are replaced atomically, so that readers never see partial values.
+func (s *Store) Put(ctx context.Context, kvmap map[string]interface{}) error {
+	for k, v := range kvmap {
+		key := strings.Trim(k, "/")
+		if key == "" || !validKey(key) {
+			return fmt.Errorf("invalid key %q", k)
+		}
+
+		err := s.write(key, []byte(cast.ToString(v)))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Watch implements kvmapstruct.Watcher by reading the directory tree
+// under prefix every PollInterval. Indexes are hashes of the kv pairs.
+func (s *Store) Watch(ctx context.Context, prefix string, index uint64) (map[string]interface{}, uint64, error) {
+	interval := s.PollInterval
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+
+	for {
+		m, err := s.List(ctx, prefix)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		i := hashKVMap(m)
+		if i != index {
+			return m, i, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, 0, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// walk reads recursively the files of the directory dir into m.
+func (s *Store) walk(dir string, m map[string]interface{}) error {
+	entries, err := ioutil.ReadDir(s.path(dir))
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+
+		key := e.Name()
+		if dir != "" {
+			key = dir + "/" + key
+		}
+
+		// Follow symbolic links
+		info, err := os.Stat(s.path(key))
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			err = s.walk(key, m)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		v, err := s.read(key)
+		if err != nil {
+			return err
+		}
+
+		m[key] = v
+	}
+
+	return nil
+}
+
+// read returns the content of the file of key.
+func (s *Store) read(key string) (string, error) {
+	b, err := ioutil.ReadFile(s.path(key))
+	if err != nil {
+		return "", err
+	}
+
+	v := string(b)
+	if s.TrimNewline {
+		v = strings.TrimSuffix(strings.TrimSuffix(v, "\n"), "\r")
+	}
+
+	return v, nil
+}
+
+// write replaces the file of key with a temporary file renamed over it.
+func (s *Store) write(key string, value []byte) error {
+	filename := s.path(key)
+
+	err := os.MkdirAll(filepath.Dir(filename), 0755)
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(filename), ".tmp-")
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(value)
+	if err == nil {
+		err = f.Chmod(s.perm())
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), filename)
+	}
+
+	if err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("error writing key %s: %s", key, err)
+	}
+
+	return nil
+}
+
+// path returns the file path of key.
+func (s *Store) path(key string) string {
+	return filepath.Join(s.Dir, filepath.FromSlash(key))
+}
+
+// perm returns Perm or 0644 if it is not set.
+func (s *Store) perm() os.FileMode {
+	if s.Perm == 0 {
+		return 0644
+	}
+
+	return s.Perm
+}
+
+// validKey checks that no segment of key is ignored by List
+// or escapes the root directory.
+func validKey(key string) bool {
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || strings.HasPrefix(segment, ".") {
+			return false
+		}
+	}
+
+	return true
+}
+
+// hashKVMap returns a non zero hash of the kv pairs of m.
+func hashKVMap(m map[string]interface{}) uint64 {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	h := fnv.New64a()
+	for _, k := range keys {
+		fmt.Fprintf(h, "%d:%s%d:%s", len(k), k, len(cast.ToString(m[k])), m[k])
+	}
+
+	if i := h.Sum64(); i != 0 {
+		return i
+	}
+
+	return 1
+}
@@ -0,0 +1,107 @@
+package filestore
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/uthng/kvmapstruct/internal/storetest"
+)
+
+func TestStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filestore")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	store := New(dir)
+
+	storetest.Run(t, store, "app")
+
+	// Key segments are directories
+	b, err := ioutil.ReadFile(filepath.Join(dir, "app", "DB", "Host"))
+	if err != nil || string(b) != "db.prod" {
+		t.Errorf("wrong file app/DB/Host: %s %v", b, err)
+	}
+
+	for _, k := range []string{"app/../x", "app/.hidden", "app//x"} {
+		err = store.Put(context.Background(), map[string]interface{}{k: "v"})
+		if err == nil {
+			t.Errorf("key %s written", k)
+		}
+	}
+
+	for _, p := range []string{"../etc", "app/../..", "app/./DB", "app//DB"} {
+		_, err = store.List(context.Background(), p)
+		if err == nil {
+			t.Errorf("prefix %s listed", p)
+		}
+	}
+
+}
+
+func TestStoreConfigMapVolume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filestore")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Layout of a ConfigMap volume: keys are symbolic links
+	// to files of a timestamped directory through ..data
+	data := filepath.Join(dir, "..2020_01_01_00_00_00.000000000")
+	err = os.Mkdir(data, 0755)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	for k, v := range map[string]string{"Env": "prod\n", "Workers": "4\n"} {
+		err = ioutil.WriteFile(filepath.Join(data, k), []byte(v), 0644)
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+
+		err = os.Symlink(filepath.Join("..data", k), filepath.Join(dir, k))
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+	}
+
+	err = os.Symlink(filepath.Base(data), filepath.Join(dir, "..data"))
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	store := New(dir)
+	store.TrimNewline = true
+
+	m, err := store.List(context.Background(), "")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	want := map[string]interface{}{"Env": "prod", "Workers": "4"}
+	if !reflect.DeepEqual(m, want) {
+		t.Errorf("\nwant:\n%v\nhave:\n%v", want, m)
+	}
+
+}
+
+func TestStoreWatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filestore")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	store := New(dir)
+	store.PollInterval = 10 * time.Millisecond
+
+	storetest.RunWatch(t, store, "app")
+
+}
@@ -0,0 +1,234 @@
+package kvmapstruct
+
+import (
+	"flag"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/spf13/cast"
+)
+
+// Flags are command-line flags generated from a Go struct layout,
+// one per leaf key path. Maps are not bound to flags.
+// Names are lower case key path segments joined by dots:
+// the key DB/MaxConns is bound to the flag db.max-conns.
+// Slices are set with comma separated values, an empty value empties them.
+type Flags struct {
+	// Values are the flag values in field order
+	Values []*FlagValue
+
+	typ reflect.Type
+}
+
+// FlagValue is the value of a single flag. It implements flag.Value
+// and pflag.Value, so it can be registered on a pflag.FlagSet with
+//
+//	pfs.Var(v, v.Name, v.Usage)
+//
+// Boolean flags need NoOptDefVal set to "true" with pflag.
+type FlagValue struct {
+	// Name is the flag name
+	Name string
+	// Usage is the flag usage from the description tag
+	Usage string
+	// Key is the relative key path set by the flag
+	Key string
+
+	field structField
+	value string
+	set   bool
+}
+
+// NewFlags generates the flags of the Go struct st.
+// Default values come from the default tags of the fields.
+// st argument can be a Go struct or a pointer to a Go struct,
+// initialized or not.
+func NewFlags(st interface{}) *Flags {
+	f := &Flags{
+		typ: reflect.TypeOf(st),
+	}
+
+	for _, field := range structFields(reflect.TypeOf(st), "") {
+		if field.Field.Type.Kind() == reflect.Map {
+			continue
+		}
+
+		f.Values = append(f.Values, &FlagValue{
+			Name:  flagName(field.Key),
+			Usage: field.Field.Tag.Get(descriptionTagName),
+			Key:   field.Key,
+			field: field,
+			value: field.Field.Tag.Get(defaultTagName),
+		})
+	}
+
+	return f
+}
+
+// BindFlags generates the flags of the Go struct st
+// and registers them on the flag set fs.
+func BindFlags(fs *flag.FlagSet, st interface{}) *Flags {
+	f := NewFlags(st)
+	f.Bind(fs)
+
+	return f
+}
+
+// Bind registers all flags on the flag set fs.
+func (f *Flags) Bind(fs *flag.FlagSet) {
+	for _, v := range f.Values {
+		fs.Var(v, v.Name, v.Usage)
+	}
+}
+
+// Layer returns the flags set on the command line as a layer
+// for LayersToStruct. It is meant to be the last layer, so that
+// flags have the highest priority. Sources of its keys are the
+// flag names.
+func (f *Flags) Layer() Layer {
+	l := Layer{
+		Name:    "flags",
+		KVMap:   make(map[string]interface{}),
+		origins: make(map[string]string),
+		kind:    SourceFlag,
+	}
+
+	for _, v := range f.Values {
+		if !v.set {
+			continue
+		}
+
+		if v.field.Field.Type.Kind() == reflect.Slice {
+			// An empty value redefines the slice with no element
+			elems := splitList(v.value)
+			if len(elems) == 0 {
+				if l.empty == nil {
+					l.empty = make(map[string]bool)
+				}
+
+				l.empty[v.Key] = true
+			}
+
+			for i, e := range elems {
+				k := v.Key + "/" + strconv.Itoa(i)
+				l.KVMap[k] = e
+				l.origins[k] = "-" + v.Name
+			}
+			continue
+		}
+
+		l.KVMap[v.Key] = v.value
+		l.origins[v.Key] = "-" + v.Name
+	}
+
+	return l
+}
+
+// Overlay returns a copy of the KV map in with the values of
+// the flags set on the command line at their keys under prefix.
+func (f *Flags) Overlay(in map[string]interface{}, prefix string) map[string]interface{} {
+	var st interface{}
+
+	// Struct type is needed to replace slices as a whole
+	if f.typ != nil {
+		st = reflect.Zero(f.typ).Interface()
+	}
+
+	return overlayLayer(in, prefix, st, f.Layer())
+}
+
+// String implements flag.Value.
+func (v *FlagValue) String() string {
+	if v == nil {
+		return ""
+	}
+
+	return v.value
+}
+
+// Set implements flag.Value. It checks that the value
+// can be converted to the field type.
+func (v *FlagValue) Set(s string) error {
+	t := v.field.Field.Type
+
+	values := []string{s}
+	if t.Kind() == reflect.Slice {
+		t = t.Elem()
+		values = splitList(s)
+	}
+
+	for _, e := range values {
+		var err error
+
+		switch t.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			_, err = cast.ToInt64E(e)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			_, err = cast.ToUint64E(e)
+		case reflect.Float32, reflect.Float64:
+			_, err = cast.ToFloat64E(e)
+		case reflect.Bool:
+			_, err = strconv.ParseBool(e)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	v.value = s
+	v.set = true
+
+	return nil
+}
+
+// Type implements pflag.Value.
+func (v *FlagValue) Type() string {
+	return v.field.Field.Type.String()
+}
+
+// IsBoolFlag allows boolean flags without value: -debug instead of -debug=true.
+func (v *FlagValue) IsBoolFlag() bool {
+	return v.field.Field.Type.Kind() == reflect.Bool
+}
+
+// IsSet returns true if the flag was set on the command line.
+func (v *FlagValue) IsSet() bool {
+	return v.set
+}
+
+// flagName converts a key path to a flag name: segments are
+// converted to kebab case and joined by dots.
+func flagName(key string) string {
+	var parts []string
+
+	for _, segment := range strings.Split(key, "/") {
+		var b strings.Builder
+
+		runes := []rune(segment)
+		for i, r := range runes {
+			// Start a new word at an upper case letter following a lower
+			// case one, or preceding a lower case one in an acronym
+			if i > 0 && unicode.IsUpper(r) &&
+				(unicode.IsLower(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsUpper(runes[i-1]))) {
+				b.WriteRune('-')
+			}
+			b.WriteRune(unicode.ToLower(r))
+		}
+
+		parts = append(parts, b.String())
+	}
+
+	return strings.Join(parts, ".")
+}
+
+// splitList splits a comma separated list. An empty string is an empty list.
+func splitList(s string) []string {
+	if s == "" {
+		return nil
+	}
+
+	return strings.Split(s, ",")
+}
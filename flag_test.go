@@ -0,0 +1,110 @@
+package kvmapstruct
+
+import (
+	"flag"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func TestBindFlags(t *testing.T) {
+	type STChild struct {
+		Host     string `default:"localhost" description:"Database host"`
+		MaxConns int
+	}
+
+	type ST struct {
+		Env      string
+		HTTPPort int
+		Debug    bool
+		Hosts    []string
+		Labels   map[string]interface{}
+		DB       *STChild
+	}
+
+	testCases := []struct {
+		name   string
+		args   []string
+		input  map[string]interface{}
+		output map[string]interface{}
+		err    bool
+	}{
+		{
+			"FlagsOverrideConsul",
+			[]string{"-env=prod", "-debug", "-hosts=host1,host2", "-db.max-conns=10"},
+			map[string]interface{}{
+				"test/Env":      "dev",
+				"test/HTTPPort": "8080",
+				"test/Hosts/0":  "local1",
+				"test/Hosts/1":  "local2",
+				"test/Hosts/2":  "local3",
+				"test/DB/Host":  "db",
+			},
+			map[string]interface{}{
+				"test/Env":         "prod",
+				"test/HTTPPort":    "8080",
+				"test/Debug":       "true",
+				"test/Hosts/0":     "host1",
+				"test/Hosts/1":     "host2",
+				"test/DB/Host":     "db",
+				"test/DB/MaxConns": "10",
+			},
+			false,
+		},
+		{
+			"EmptyList",
+			[]string{"-hosts="},
+			map[string]interface{}{
+				"test/Env":     "dev",
+				"test/Hosts/0": "local1",
+				"test/Hosts/1": "local2",
+			},
+			map[string]interface{}{
+				"test/Env": "dev",
+			},
+			false,
+		},
+		{
+			"InvalidFlagValue",
+			[]string{"-http-port=abc"},
+			map[string]interface{}{},
+			map[string]interface{}{},
+			true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fs := flag.NewFlagSet(tc.name, flag.ContinueOnError)
+			fs.SetOutput(ioutil.Discard)
+
+			flags := BindFlags(fs, &ST{})
+
+			err := fs.Parse(tc.args)
+			if (err != nil) != tc.err {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if err != nil {
+				return
+			}
+
+			o := flags.Overlay(tc.input, "test")
+
+			if !reflect.DeepEqual(o, tc.output) {
+				t.Errorf("\nwant:\n%v\nhave:\n%v", tc.output, o)
+			}
+
+			// Defaults and usages come from tags
+			f := fs.Lookup("db.host")
+			if f == nil || f.DefValue != "localhost" || f.Usage != "Database host" {
+				t.Errorf("wrong flag db.host: %v", f)
+			}
+
+			if fs.Lookup("labels") != nil {
+				t.Errorf("map field bound to a flag")
+			}
+		})
+	}
+
+}
@@ -0,0 +1,166 @@
+package kvmapstruct
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// WatchRetryInterval is the time Watch waits before retrying
+// after an error of the store.
+var WatchRetryInterval = 5 * time.Second
+
+// Update is a new value of a watched Go struct, or the error
+// encountered while watching or decoding it.
+type Update[T any] struct {
+	// Value is the decoded Go struct
+	Value T
+	// Index is the store index of the kv pairs Value was decoded from
+	Index uint64
+	// Err is the error of the store or of the decoding
+	Err error
+}
+
+// secretStore is a Store encrypting and decrypting secret fields.
+type secretStore interface {
+	encryptKVMap(m map[string]interface{}, secrets []structField) error
+	decryptKVMap(m map[string]interface{}, secrets []structField) error
+}
+
+// Load gets all kv pairs under prefix from store and decodes them
+// into a new value of type T, which must be a Go struct or a pointer
+// to a Go struct. Pointers to substructs are allocated. Secret fields
+// are decrypted if store is a *KVMapStruct.
+func Load[T any](ctx context.Context, store Store, prefix string) (T, error) {
+	var zero T
+
+	m, err := store.List(ctx, prefix)
+	if err != nil {
+		return zero, err
+	}
+
+	return decodeKVMap[T](store, m, prefix)
+}
+
+// Save converts v, a Go struct or a pointer to a Go struct, to kv pairs
+// under prefix and writes them to store. Secret fields are encrypted if
+// store is a *KVMapStruct.
+func Save[T any](ctx context.Context, store Store, prefix string, v T) error {
+	in, err := inputToMap(v)
+	if err != nil {
+		return err
+	}
+
+	m := MapToKVMap(in, prefix)
+
+	if s, ok := store.(secretStore); ok {
+		err = s.encryptKVMap(m, secretFields(reflect.TypeOf(v), prefix))
+		if err != nil {
+			return err
+		}
+	}
+
+	return store.Put(ctx, m)
+}
+
+// Watch decodes the kv pairs under prefix into a new value of type T
+// each time they change and sends it on the returned channel. The first
+// update is the current value. Errors are sent as updates too: decoding
+// errors are not retried until the kv pairs change again and store errors
+// are retried after WatchRetryInterval. The channel is closed when ctx
+// is done. T follows the same rules as for Load.
+func Watch[T any](ctx context.Context, w Watcher, prefix string) <-chan Update[T] {
+	ch := make(chan Update[T])
+
+	go func() {
+		defer close(ch)
+
+		var index uint64
+
+		for {
+			m, i, err := w.Watch(ctx, prefix, index)
+			if ctx.Err() != nil {
+				return
+			}
+
+			if err != nil {
+				if !sendUpdate(ctx, ch, Update[T]{Index: index, Err: err}) {
+					return
+				}
+
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(WatchRetryInterval):
+				}
+
+				continue
+			}
+
+			// Wait time expired without change
+			if i == index {
+				continue
+			}
+
+			index = i
+
+			v, err := decodeKVMap[T](w, m, prefix)
+			if !sendUpdate(ctx, ch, Update[T]{Value: v, Index: index, Err: err}) {
+				return
+			}
+		}
+	}()
+
+	return ch
+}
+
+// sendUpdate sends u on ch. It returns false if ctx is done first.
+func sendUpdate[T any](ctx context.Context, ch chan<- Update[T], u Update[T]) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case ch <- u:
+		return true
+	}
+}
+
+// decodeKVMap decodes the KV map m, whose keys are under prefix,
+// into a new value of type T.
+func decodeKVMap[T any](store Store, m map[string]interface{}, prefix string) (T, error) {
+	var zero T
+
+	t := reflect.TypeOf(zero)
+	if t == nil {
+		return zero, fmt.Errorf("Error: type is neither a Go struct nor a pointer to a Go struct")
+	}
+
+	st := t
+	if t.Kind() == reflect.Ptr {
+		st = t.Elem()
+	}
+
+	if st.Kind() != reflect.Struct {
+		return zero, fmt.Errorf("Error: type %s is neither a Go struct nor a pointer to a Go struct", t)
+	}
+
+	if s, ok := store.(secretStore); ok {
+		err := s.decryptKVMap(m, secretFields(st, prefix))
+		if err != nil {
+			return zero, err
+		}
+	}
+
+	out := newStruct(st)
+
+	err := KVMapToStruct(m, prefix, out.Interface())
+	if err != nil {
+		return zero, err
+	}
+
+	if t.Kind() == reflect.Ptr {
+		return out.Interface().(T), nil
+	}
+
+	return out.Elem().Interface().(T), nil
+}
@@ -0,0 +1,275 @@
+package kvmapstruct
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/cast"
+
+	"github.com/uthng/kvmapstruct/internal/kvpath"
+)
+
+type genericDB struct {
+	Host string
+	Port int
+}
+
+type genericST struct {
+	Env      string `validate:"oneof=dev prod"`
+	Workers  int
+	Password string `kv:",secret"`
+	DB       *genericDB
+}
+
+// memStore is an in-memory Watcher.
+type memStore struct {
+	mu      sync.Mutex
+	data    map[string]string
+	index   uint64
+	changed chan struct{}
+}
+
+func newMemStore() *memStore {
+	return &memStore{
+		data:    make(map[string]string),
+		changed: make(chan struct{}),
+	}
+}
+
+func (s *memStore) List(ctx context.Context, prefix string) (map[string]interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m := make(map[string]interface{})
+	for k, v := range s.data {
+		if kvpath.InPath(k, prefix) {
+			m[k] = v
+		}
+	}
+
+	return m, nil
+}
+
+func (s *memStore) Put(ctx context.Context, kvmap map[string]interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for k, v := range kvmap {
+		s.data[k] = cast.ToString(v)
+	}
+
+	s.index++
+	close(s.changed)
+	s.changed = make(chan struct{})
+
+	return nil
+}
+
+func (s *memStore) Watch(ctx context.Context, prefix string, index uint64) (map[string]interface{}, uint64, error) {
+	s.mu.Lock()
+	changed := s.changed
+	current := s.index
+	s.mu.Unlock()
+
+	if index == current {
+		select {
+		case <-ctx.Done():
+			return nil, 0, ctx.Err()
+		case <-changed:
+		}
+	}
+
+	s.mu.Lock()
+	current = s.index
+	s.mu.Unlock()
+
+	m, err := s.List(ctx, prefix)
+
+	return m, current, err
+}
+
+func TestLoadSave(t *testing.T) {
+	ctx := context.Background()
+	store := newMemStore()
+
+	in := genericST{
+		Env:      "prod",
+		Workers:  4,
+		Password: "secret",
+		DB:       &genericDB{Host: "db.prod", Port: 5432},
+	}
+
+	err := Save(ctx, store, "test", in)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	// Secret fields are only encrypted by *KVMapStruct
+	if store.data["test/Password"] != "secret" {
+		t.Errorf("wrong stored password: %s", store.data["test/Password"])
+	}
+
+	out, err := Load[genericST](ctx, store, "test")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("\nwant:\n%v\nhave:\n%v", in, out)
+	}
+
+	ptr, err := Load[*genericST](ctx, store, "test")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if !reflect.DeepEqual(ptr, &in) {
+		t.Errorf("\nwant:\n%v\nhave:\n%v", &in, ptr)
+	}
+
+	_, err = Load[map[string]interface{}](ctx, store, "test")
+	if err == nil || !strings.Contains(err.Error(), "neither a Go struct") {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+}
+
+func TestWatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	store := newMemStore()
+
+	err := store.Put(ctx, map[string]interface{}{"test/Env": "dev"})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	ch := Watch[genericST](ctx, store, "test")
+
+	testCases := []struct {
+		name   string
+		put    map[string]interface{}
+		output string
+		err    bool
+	}{
+		{"Initial", nil, "dev", false},
+		{"Changed", map[string]interface{}{"test/Env": "prod"}, "prod", false},
+		{"ValidationError", map[string]interface{}{"test/Env": "qa"}, "", true},
+	}
+
+	for _, tc := range testCases {
+		if tc.put != nil {
+			err := store.Put(ctx, tc.put)
+			if err != nil {
+				t.Fatalf("%s", err)
+			}
+		}
+
+		select {
+		case u := <-ch:
+			if (u.Err != nil) != tc.err {
+				t.Errorf("%s: unexpected error: %v", tc.name, u.Err)
+			}
+
+			if u.Value.Env != tc.output {
+				t.Errorf("%s: want %s, have %s", tc.name, tc.output, u.Value.Env)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: no update", tc.name)
+		}
+	}
+
+	cancel()
+
+	select {
+	case _, ok := <-ch:
+		if ok {
+			t.Errorf("channel not closed")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("channel not closed")
+	}
+
+}
+
+func TestLoadSaveConsul(t *testing.T) {
+	ctx := context.Background()
+
+	kms, err := NewKVMapStruct("localhost:8500", "adf4238a-882b-9ddc-4a9d-5b6758e4159e", "test")
+	if err != nil {
+		t.Errorf("%s", err.Error())
+	}
+
+	dir, err := ioutil.TempDir("", "kvmapstruct")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "key")
+	err = ioutil.WriteFile(filename, []byte("0123456789abcdef0123456789abcdef"), 0600)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	kms.KeyProvider = NewKeyFileProvider(filename)
+	defer kms.Client.KV().DeleteTree("test", nil)
+
+	in := &genericST{
+		Env:      "prod",
+		Workers:  4,
+		Password: "secret",
+		DB:       &genericDB{Host: "db.prod", Port: 5432},
+	}
+
+	err = Save(ctx, kms, "test", in)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	kv, _, err := kms.Client.KV().Get("test/Password", nil)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if kv == nil || !strings.HasPrefix(string(kv.Value), secretPrefix) {
+		t.Errorf("password not encrypted: %v", kv)
+	}
+
+	out, err := Load[*genericST](ctx, kms, "test")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("\nwant:\n%v\nhave:\n%v", in, out)
+	}
+
+	wctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	ch := Watch[*genericST](wctx, kms, "test")
+
+	for _, env := range []string{"prod", "dev"} {
+		select {
+		case u := <-ch:
+			if u.Err != nil || u.Value.Env != env || u.Index == 0 {
+				t.Errorf("wrong update: %v", u)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no update")
+		}
+
+		err = kms.Put(ctx, map[string]interface{}{"test/Env": "dev"})
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+	}
+
+}
@@ -0,0 +1,27 @@
+// Package kvpath handles the "/" separated key paths shared by
+// kvmapstruct and its store backends.
+package kvpath
+
+import "strings"
+
+// InPath checks if key is path itself or a key under path. Keys only
+// sharing path as string prefix, test2/key1 for path test for example,
+// are not under path. Every key is under the empty path.
+func InPath(key, path string) bool {
+	if path == "" || key == path {
+		return true
+	}
+
+	return strings.HasPrefix(key, strings.TrimSuffix(path, "/")+"/")
+}
+
+// Split splits a key path into its segments. Leading and trailing
+// slashes are ignored and the empty path has no segment.
+func Split(key string) []string {
+	key = strings.Trim(key, "/")
+	if key == "" {
+		return nil
+	}
+
+	return strings.Split(key, "/")
+}
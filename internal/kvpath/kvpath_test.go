@@ -0,0 +1,47 @@
+package kvpath
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestInPath(t *testing.T) {
+	testCases := []struct {
+		key    string
+		path   string
+		output bool
+	}{
+		{"test/key1", "", true},
+		{"test", "test", true},
+		{"test/key1", "test", true},
+		{"test/key1", "test/", true},
+		{"test2/key1", "test", false},
+		{"test", "test/key1", false},
+	}
+
+	for _, tc := range testCases {
+		if o := InPath(tc.key, tc.path); o != tc.output {
+			t.Errorf("%s in %s: want %v, have %v", tc.key, tc.path, tc.output, o)
+		}
+	}
+
+}
+
+func TestSplit(t *testing.T) {
+	testCases := []struct {
+		input  string
+		output []string
+	}{
+		{"", nil},
+		{"/", nil},
+		{"app", []string{"app"}},
+		{"/app/DB/Host/", []string{"app", "DB", "Host"}},
+	}
+
+	for _, tc := range testCases {
+		if o := Split(tc.input); !reflect.DeepEqual(o, tc.output) {
+			t.Errorf("\nwant:\n%v\nhave:\n%v", tc.output, o)
+		}
+	}
+
+}
@@ -0,0 +1,155 @@
+// Package storetest is the test suite shared by the kvmapstruct.Store
+// backends. Backends run it against an empty store and keep only their
+// specific cases in their own tests.
+package storetest
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/uthng/kvmapstruct"
+)
+
+// DB is the substruct of Config.
+type DB struct {
+	Host string
+	Port int
+}
+
+// Config is the Go struct saved by the suite.
+type Config struct {
+	Env   string
+	Hosts []string
+	DB    *DB
+}
+
+// NewConfig returns the Config saved by Run.
+func NewConfig() *Config {
+	return &Config{
+		Env:   "prod",
+		Hosts: []string{"host1", "host2"},
+		DB:    &DB{Host: "db.prod", Port: 5432},
+	}
+}
+
+// Run saves NewConfig under prefix, loads it back and lists keys,
+// subtrees and missing keys under prefix. A sibling key sharing
+// prefix as string prefix is saved too and must never be listed.
+func Run(t *testing.T, store kvmapstruct.Store, prefix string) {
+	ctx := context.Background()
+	in := NewConfig()
+
+	err := kvmapstruct.Save(ctx, store, prefix, in)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	err = store.Put(ctx, map[string]interface{}{prefix + "2/Env": "other"})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	out, err := kvmapstruct.Load[*Config](ctx, store, prefix)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("\nwant:\n%v\nhave:\n%v", in, out)
+	}
+
+	testCases := []struct {
+		name   string
+		prefix string
+		output map[string]interface{}
+	}{
+		{
+			"Prefix",
+			prefix,
+			map[string]interface{}{
+				prefix + "/Env":     "prod",
+				prefix + "/Hosts/0": "host1",
+				prefix + "/Hosts/1": "host2",
+				prefix + "/DB/Host": "db.prod",
+				prefix + "/DB/Port": "5432",
+			},
+		},
+		{
+			"Key",
+			prefix + "/DB/Host",
+			map[string]interface{}{prefix + "/DB/Host": "db.prod"},
+		},
+		{
+			"Subtree",
+			prefix + "/Hosts",
+			map[string]interface{}{prefix + "/Hosts/0": "host1", prefix + "/Hosts/1": "host2"},
+		},
+		{
+			"Missing",
+			prefix + "/Other",
+			map[string]interface{}{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := store.List(ctx, tc.prefix)
+			if err != nil {
+				t.Fatalf("%s", err)
+			}
+
+			if !reflect.DeepEqual(m, tc.output) {
+				t.Errorf("\nwant:\n%v\nhave:\n%v", tc.output, m)
+			}
+		})
+	}
+
+}
+
+// RunWatch watches the Config under prefix with kvmapstruct.Watch and
+// checks that a change of Env is sent as an update and that changes
+// of a sibling key sharing prefix as string prefix are not.
+func RunWatch(t *testing.T, w kvmapstruct.Watcher, prefix string) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	err := w.Put(ctx, map[string]interface{}{prefix + "/Env": "dev"})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	ch := kvmapstruct.Watch[Config](ctx, w, prefix)
+
+	for _, env := range []string{"dev", "prod"} {
+		select {
+		case u := <-ch:
+			if u.Err != nil || u.Value.Env != env {
+				t.Errorf("wrong update: %v", u)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no update")
+		}
+
+		// Let the watch block before changing the sibling key
+		time.Sleep(100 * time.Millisecond)
+
+		err = w.Put(ctx, map[string]interface{}{prefix + "2/Env": "other"})
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+
+		select {
+		case u := <-ch:
+			t.Fatalf("update on sibling change: %v", u)
+		case <-time.After(200 * time.Millisecond):
+		}
+
+		err = w.Put(ctx, map[string]interface{}{prefix + "/Env": "prod"})
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+	}
+
+}
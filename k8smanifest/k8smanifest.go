@@ -0,0 +1,290 @@
+// Package k8smanifest converts Go structs to Kubernetes ConfigMap and
+// Secret manifests and back, so that the same config types can be read
+// from Consul or from a cluster manifest.
+//
+// Key paths are encoded into valid ConfigMap keys: segments are joined
+// by dots and characters other than letters, digits and dashes are
+// escaped as an underscore followed by their hexadecimal code. The key
+// DB/Host is DB.Host and Labels/team.name is Labels.team_2ename.
+//
+// Values of fields tagged with `kv:",secret"` or `kv:",sensitive"` go to
+// the Secret, the others to the ConfigMap.
+package k8smanifest
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/fatih/structs"
+	"github.com/spf13/cast"
+	"sigs.k8s.io/yaml"
+
+	"github.com/uthng/kvmapstruct"
+)
+
+// maxKeyLength is the maximum length of ConfigMap and Secret keys.
+const maxKeyLength = 253
+
+// Manifest is a Kubernetes ConfigMap or Secret.
+type Manifest struct {
+	APIVersion string            `json:"apiVersion"`
+	Kind       string            `json:"kind"`
+	Metadata   Metadata          `json:"metadata"`
+	Type       string            `json:"type,omitempty"`
+	Data       map[string]string `json:"data,omitempty"`
+	StringData map[string]string `json:"stringData,omitempty"`
+}
+
+// Metadata is the metadata of a manifest.
+type Metadata struct {
+	Name      string            `json:"name"`
+	Namespace string            `json:"namespace,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+}
+
+// docSeparator separates documents of a YAML stream.
+var docSeparator = regexp.MustCompile(`(?m)^---\s*$`)
+
+// StructToManifests converts the Go struct st to a ConfigMap and a Secret
+// named name in namespace. Data of the Secret is base64 encoded. Secret is
+// nil if st has no secret nor sensitive values. st argument can be a Go
+// struct or a pointer to a Go struct.
+func StructToManifests(st interface{}, name, namespace string) (*Manifest, *Manifest, error) {
+	var secret *Manifest
+
+	if !structs.IsStruct(st) {
+		return nil, nil, fmt.Errorf("Error: input is not a Go struct")
+	}
+
+	m := kvmapstruct.MapToKVMap(structs.Map(st), "")
+
+	configMap := &Manifest{
+		APIVersion: "v1",
+		Kind:       "ConfigMap",
+		Metadata:   Metadata{Name: name, Namespace: namespace},
+		Data:       make(map[string]string),
+	}
+
+	var sensitives []string
+	for _, spec := range kvmapstruct.KeySpecs(st, "") {
+		if spec.Sensitive {
+			sensitives = append(sensitives, spec.Key)
+		}
+	}
+
+	for k, v := range m {
+		key, err := EncodeKey(k)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if !matchKeys(sensitives, k) {
+			configMap.Data[key] = cast.ToString(v)
+			continue
+		}
+
+		if secret == nil {
+			secret = &Manifest{
+				APIVersion: "v1",
+				Kind:       "Secret",
+				Metadata:   Metadata{Name: name, Namespace: namespace},
+				Type:       "Opaque",
+				Data:       make(map[string]string),
+			}
+		}
+
+		secret.Data[key] = base64.StdEncoding.EncodeToString([]byte(cast.ToString(v)))
+	}
+
+	return configMap, secret, nil
+}
+
+// ManifestsToStruct decodes the data of ConfigMaps and Secrets into the
+// Go struct out. Later manifests override earlier ones key by key.
+// Out argument follows the same rules as for kvmapstruct.KVMapToStruct.
+func ManifestsToStruct(out interface{}, manifests ...*Manifest) error {
+	m := make(map[string]interface{})
+
+	for _, manifest := range manifests {
+		kvmap, err := manifest.KVMap()
+		if err != nil {
+			return err
+		}
+
+		for k, v := range kvmap {
+			m[k] = v
+		}
+	}
+
+	return kvmapstruct.KVMapToStruct(m, "", out)
+}
+
+// KVMap returns the data of the manifest as a KV map with decoded keys.
+// Data of Secrets is base64 decoded and overridden by StringData.
+func (m *Manifest) KVMap() (map[string]interface{}, error) {
+	out := make(map[string]interface{})
+
+	switch m.Kind {
+	case "ConfigMap", "Secret":
+	default:
+		return nil, fmt.Errorf("kind %s is neither ConfigMap nor Secret", m.Kind)
+	}
+
+	for k, v := range m.Data {
+		key, err := DecodeKey(k)
+		if err != nil {
+			return nil, err
+		}
+
+		if m.Kind == "Secret" {
+			b, err := base64.StdEncoding.DecodeString(v)
+			if err != nil {
+				return nil, fmt.Errorf("error decoding key %s of secret %s: %s", k, m.Metadata.Name, err)
+			}
+			v = string(b)
+		}
+
+		out[key] = v
+	}
+
+	for k, v := range m.StringData {
+		key, err := DecodeKey(k)
+		if err != nil {
+			return nil, err
+		}
+
+		out[key] = v
+	}
+
+	return out, nil
+}
+
+// YAML returns the manifest as YAML.
+func (m *Manifest) YAML() ([]byte, error) {
+	return yaml.Marshal(m)
+}
+
+// MarshalYAML returns the non nil manifests as a YAML stream.
+func MarshalYAML(manifests ...*Manifest) ([]byte, error) {
+	var buf bytes.Buffer
+
+	for _, m := range manifests {
+		if m == nil {
+			continue
+		}
+
+		b, err := m.YAML()
+		if err != nil {
+			return nil, err
+		}
+
+		if buf.Len() > 0 {
+			buf.WriteString("---\n")
+		}
+		buf.Write(b)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// ParseYAML parses a YAML stream of ConfigMaps and Secrets.
+// Empty documents are skipped.
+func ParseYAML(data []byte) ([]*Manifest, error) {
+	var manifests []*Manifest
+
+	for i, doc := range docSeparator.Split(string(data), -1) {
+		if strings.TrimSpace(doc) == "" {
+			continue
+		}
+
+		m := &Manifest{}
+
+		err := yaml.Unmarshal([]byte(doc), m)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing document %d: %s", i, err)
+		}
+
+		switch m.Kind {
+		case "ConfigMap", "Secret":
+		default:
+			return nil, fmt.Errorf("document %d: kind %s is neither ConfigMap nor Secret", i, m.Kind)
+		}
+
+		manifests = append(manifests, m)
+	}
+
+	return manifests, nil
+}
+
+// EncodeKey encodes a key path into a valid ConfigMap key.
+func EncodeKey(key string) (string, error) {
+	var b strings.Builder
+
+	for i, segment := range strings.Split(key, "/") {
+		if segment == "" {
+			return "", fmt.Errorf("invalid key %q: empty segment", key)
+		}
+
+		if i > 0 {
+			b.WriteByte('.')
+		}
+
+		for j := 0; j < len(segment); j++ {
+			c := segment[j]
+			if c == '-' || (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') {
+				b.WriteByte(c)
+			} else {
+				fmt.Fprintf(&b, "_%02x", c)
+			}
+		}
+	}
+
+	if b.Len() > maxKeyLength {
+		return "", fmt.Errorf("invalid key %q: encoded key longer than %d characters", key, maxKeyLength)
+	}
+
+	return b.String(), nil
+}
+
+// DecodeKey decodes a ConfigMap key into a key path.
+func DecodeKey(key string) (string, error) {
+	var b strings.Builder
+
+	for i := 0; i < len(key); i++ {
+		switch c := key[i]; c {
+		case '.':
+			b.WriteByte('/')
+		case '_':
+			if i+2 >= len(key) {
+				return "", fmt.Errorf("invalid key %q: truncated escape", key)
+			}
+
+			n, err := strconv.ParseUint(key[i+1:i+3], 16, 8)
+			if err != nil {
+				return "", fmt.Errorf("invalid key %q: %s", key, err)
+			}
+
+			b.WriteByte(byte(n))
+			i += 2
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	return b.String(), nil
+}
+
+// matchKeys checks if key is one of keys or is under one of them.
+func matchKeys(keys []string, key string) bool {
+	for _, k := range keys {
+		if key == k || strings.HasPrefix(key, k+"/") {
+			return true
+		}
+	}
+
+	return false
+}
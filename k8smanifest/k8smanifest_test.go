@@ -0,0 +1,191 @@
+package k8smanifest
+
+import (
+	"reflect"
+	"testing"
+)
+
+type k8sDB struct {
+	Host     string
+	Port     int
+	Password string `kv:",secret"`
+}
+
+type k8sST struct {
+	Env    string
+	Hosts  []string
+	Labels map[string]interface{}
+	DB     *k8sDB
+}
+
+func TestManifests(t *testing.T) {
+	in := &k8sST{
+		Env:    "prod",
+		Hosts:  []string{"host1", "host2"},
+		Labels: map[string]interface{}{"team.name": "ops"},
+		DB:     &k8sDB{Host: "db.prod", Port: 5432, Password: "pass"},
+	}
+
+	configMap, secret, err := StructToManifests(in, "app", "default")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	wantData := map[string]string{
+		"Env":                "prod",
+		"Hosts.0":            "host1",
+		"Hosts.1":            "host2",
+		"Labels.team_2ename": "ops",
+		"DB.Host":            "db.prod",
+		"DB.Port":            "5432",
+	}
+
+	if !reflect.DeepEqual(configMap.Data, wantData) {
+		t.Errorf("\nwant:\n%v\nhave:\n%v", wantData, configMap.Data)
+	}
+
+	wantSecret := map[string]string{"DB.Password": "cGFzcw=="}
+
+	if secret == nil || !reflect.DeepEqual(secret.Data, wantSecret) {
+		t.Fatalf("\nwant:\n%v\nhave:\n%v", wantSecret, secret)
+	}
+
+	data, err := MarshalYAML(configMap, secret)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	manifests, err := ParseYAML(data)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if len(manifests) != 2 || manifests[0].Kind != "ConfigMap" || manifests[1].Kind != "Secret" {
+		t.Fatalf("wrong manifests:\n%s", data)
+	}
+
+	out := &k8sST{DB: &k8sDB{}}
+
+	err = ManifestsToStruct(out, manifests...)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("\nwant:\n%v\nhave:\n%v", in, out)
+	}
+
+}
+
+func TestParseYAML(t *testing.T) {
+	testCases := []struct {
+		name   string
+		input  string
+		output map[string]interface{}
+		err    bool
+	}{
+		{
+			"SecretStringData",
+			`apiVersion: v1
+kind: Secret
+metadata:
+  name: app
+data:
+  DB.Password: cGFzcw==
+  DB.Host: ZGIuZGV2
+stringData:
+  DB.Password: other
+`,
+			map[string]interface{}{"DB/Password": "other", "DB/Host": "db.dev"},
+			false,
+		},
+		{
+			"EmptyDocuments",
+			`---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: app
+data:
+  Env: dev
+---
+`,
+			map[string]interface{}{"Env": "dev"},
+			false,
+		},
+		{
+			"WrongKind",
+			`apiVersion: v1
+kind: Pod
+metadata:
+  name: app
+`,
+			nil,
+			true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			manifests, err := ParseYAML([]byte(tc.input))
+			if tc.err {
+				if err == nil {
+					t.Fatalf("no error")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("%s", err)
+			}
+
+			m, err := manifests[0].KVMap()
+			if err != nil {
+				t.Fatalf("%s", err)
+			}
+
+			if !reflect.DeepEqual(m, tc.output) {
+				t.Errorf("\nwant:\n%v\nhave:\n%v", tc.output, m)
+			}
+		})
+	}
+
+}
+
+func TestEncodeKey(t *testing.T) {
+	testCases := []struct {
+		input  string
+		output string
+	}{
+		{"DB/Host", "DB.Host"},
+		{"Labels/team.name", "Labels.team_2ename"},
+		{"Labels/a_b c", "Labels.a_5fb_20c"},
+		{"Hosts/0", "Hosts.0"},
+	}
+
+	for _, tc := range testCases {
+		o, err := EncodeKey(tc.input)
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+
+		if o != tc.output {
+			t.Errorf("\nwant:\n%v\nhave:\n%v", tc.output, o)
+		}
+
+		k, err := DecodeKey(o)
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+
+		if k != tc.input {
+			t.Errorf("\nwant:\n%v\nhave:\n%v", tc.input, k)
+		}
+	}
+
+	_, err := DecodeKey("DB.Ho_zz")
+	if err == nil {
+		t.Errorf("invalid escape decoded")
+	}
+
+}
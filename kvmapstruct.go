@@ -30,6 +30,8 @@ import (
 	//"github.com/uthng/common/utils"
 
 	"github.com/spf13/cast"
+
+	"github.com/uthng/kvmapstruct/internal/kvpath"
 )
 
 // KVMapStruct contains consul informations.
@@ -38,64 +40,74 @@ type KVMapStruct struct {
 	Path string
 	// Client is consul client
 	Client *consul.Client
+	// KeyProvider provides the key to encrypt and decrypt secret fields
+	KeyProvider KeyProvider
+	// EnvOverlay, if set, overrides consul values with environment variables
+	EnvOverlay *EnvOverlay
+	// NaturalSort orders kv pairs with numeric path segments compared
+	// as numbers, so that slice element Hosts/2 comes before Hosts/10
+	NaturalSort bool
+	// Namespace is the Consul Enterprise namespace of all reads and writes
+	Namespace string
+	// Partition is the Consul Enterprise admin partition of all reads and writes
+	Partition string
+	// Datacenters, if set, replicates StructToConsulKV, MapToConsulKV and
+	// Put writes to each of these datacenters. Reads are not replicated
+	// and Plan, Apply and Restore are rejected.
+	Datacenters []string
 }
 
 // NewKVMapStruct creates a new *KVMapStruct.
 // URL format is ip:port.
 func NewKVMapStruct(url, token, path string) (*KVMapStruct, error) {
-	kms := &KVMapStruct{}
-
-	kms.Path = path
-
-	// Initialize consul config
-	config := consul.DefaultConfig()
+	var opts []ClientOption
 
 	if url != "" {
-		config.Address = url
+		opts = append(opts, WithAddress(url))
 	}
 
 	if token != "" {
-		config.Token = token
-	}
-
-	// Initialize consul client
-	client, err := consul.NewClient(config)
-	if err != nil {
-		return nil, err
+		opts = append(opts, WithToken(token))
 	}
 
-	kms.Client = client
-	return kms, nil
+	return NewKVMapStructWithOptions(path, opts...)
 }
 
 // StructToConsulKV converts and saves the struct to Consul KV store
 // input argument must be a Go struct.
+// Values of fields tagged with `kv:",secret"` are encrypted
+// with the key of kvmapstruct KeyProvider.
 func (kms *KVMapStruct) StructToConsulKV(input interface{}) error {
-	m := make(map[string]interface{})
+	pairs, err := kms.structToPairs(input)
+	if err != nil {
+		return err
+	}
+
+	return kms.putPairs(pairs, nil)
+}
+
+// structToPairs converts the Go struct input to consul kv pairs
+// with encrypted secret values.
+func (kms *KVMapStruct) structToPairs(input interface{}) (consul.KVPairs, error) {
 	v := reflect.ValueOf(input)
 	k := v.Kind()
 
 	if k != reflect.Struct {
-		return fmt.Errorf("Error: input is not a Go struct")
+		return nil, fmt.Errorf("Error: input is not a Go struct")
 	}
 
-	// Convert it to Map
-	m = structs.Map(input)
-
 	// Mapping to kvpairs
-	pairs, err := kms.MapToKVPairs(m, kms.Path)
+	pairs, secrets, err := kms.inputToKVPairs(input)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	for _, kv := range pairs {
-		_, err := kms.Client.KV().Put(kv, nil)
-		if err != nil {
-			return err
-		}
+	err = kms.encryptPairs(pairs, secrets)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	return pairs, nil
 }
 
 // MapToConsulKV converts and saves the map to Consul KV store.
@@ -116,14 +128,7 @@ func (kms *KVMapStruct) MapToConsulKV(input interface{}) error {
 		return err
 	}
 
-	for _, kv := range pairs {
-		_, err := kms.Client.KV().Put(kv, nil)
-		if err != nil {
-			return err
-		}
-	}
-
-	return nil
+	return kms.putPairs(pairs, nil)
 }
 
 // ConsulKVToStruct gets list of all consul keys from kvmapstruct path
@@ -131,20 +136,13 @@ func (kms *KVMapStruct) MapToConsulKV(input interface{}) error {
 // Out argument must be a initialiezed pointer to a Go struct.
 // Its substructs can be a pointer to a struct, embedded struct or struct.
 // If it is a pointer, it must be initialized.
+// Values of fields tagged with `kv:",secret"` are decrypted
+// with the key of kvmapstruct KeyProvider.
+// If EnvOverlay is set, environment variables override consul values.
+// To fall back to cached values when Consul is unreachable, use
+// Load(ctx, NewCachedStore(kms, file), kms.Path) instead.
 func (kms *KVMapStruct) ConsulKVToStruct(out interface{}) error {
-	m := make(map[string]interface{})
-
-	pairs, _, err := kms.Client.KV().List(kms.Path, nil)
-	if err != nil {
-		return err
-	}
-
-	// Build map
-	for _, kv := range pairs {
-		m[kv.Key] = string(kv.Value)
-	}
-
-	err = KVMapToStruct(m, kms.Path, out)
+	_, err := kms.ConsulKVToStructWithOptions(out, nil)
 
 	return err
 }
@@ -152,35 +150,23 @@ func (kms *KVMapStruct) ConsulKVToStruct(out interface{}) error {
 // ConsulKVToMap gets list of all consul keys from kvmapstruct path
 // and match them to a map[string]interface{}.
 func (kms *KVMapStruct) ConsulKVToMap() (map[string]interface{}, error) {
-	m := make(map[string]interface{})
-	out := make(map[string]interface{})
-
-	pairs, _, err := kms.Client.KV().List(kms.Path, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	// Build map
-	for _, kv := range pairs {
-		m[kv.Key] = string(kv.Value)
-	}
-
-	out, err = KVMapToMap(m, kms.Path)
+	out, _, err := kms.ConsulKVToMapWithOptions(nil)
 
 	return out, err
 }
 
 // MapToKVPairs convert a nested map to an array of Consul KV pairs
+// sorted by key. Keys are compared as strings, unless NaturalSort is set.
 func (kms *KVMapStruct) MapToKVPairs(in map[string]interface{}, prefix string) (consul.KVPairs, error) {
 	var out consul.KVPairs
 
 	// Convert to flatten map
 	m := MapToKVMap(in, prefix)
 
-	for k, v := range m {
+	for _, k := range sortedKeys(m, kms.NaturalSort) {
 		kv := &consul.KVPair{
 			Key:   k,
-			Value: []byte(cast.ToString(v)),
+			Value: []byte(cast.ToString(m[k])),
 		}
 
 		out = append(out, kv)
@@ -198,8 +184,10 @@ func MapToKVMap(in map[string]interface{}, prefix string) map[string]interface{}
 		key = prefix + "/"
 	}
 
-	// Loop map to build
-	for k, v := range in {
+	// Loop map in key order to build, so that the last
+	// of colliding keys (a/b and a: {b}) always wins
+	for _, k := range sortedKeys(in, false) {
+		v := in[k]
 		kind := reflect.ValueOf(v).Kind()
 		if kind == reflect.Map {
 			o := MapToKVMap(v.(map[string]interface{}), key+k)
@@ -221,6 +209,10 @@ func MapToKVMap(in map[string]interface{}, prefix string) map[string]interface{}
 				for i, e := range v.([]bool) {
 					out[key+k+"/"+cast.ToString(i)] = e
 				}
+			case []interface{}:
+				for i, e := range v.([]interface{}) {
+					out[key+k+"/"+cast.ToString(i)] = e
+				}
 			}
 		} else {
 			out[key+k] = v
@@ -239,8 +231,10 @@ func MapToFlattenMap(in map[string]interface{}, prefix string) map[string]interf
 		key = prefix + "/"
 	}
 
-	// Loop map to build
-	for k, v := range in {
+	// Loop map in key order to build, so that the last
+	// of colliding keys (a/b and a: {b}) always wins
+	for _, k := range sortedKeys(in, false) {
+		v := in[k]
 		kind := reflect.ValueOf(v).Kind()
 		if kind == reflect.Map {
 			o := MapToFlattenMap(v.(map[string]interface{}), key+k)
@@ -260,6 +254,8 @@ func MapToFlattenMap(in map[string]interface{}, prefix string) map[string]interf
 				out[key+k] = v.([]string)
 			case []bool:
 				out[key+k] = v.([]bool)
+			case []interface{}:
+				out[key+k] = v.([]interface{})
 			}
 		} else {
 			out[key+k] = v
@@ -273,6 +269,7 @@ func MapToFlattenMap(in map[string]interface{}, prefix string) map[string]interf
 // Out argument must be a initialiezed pointer to a Go struct.
 // Its substructs can be a pointer to a struct, embedded struct or struct.
 // If it is a pointer, it must be initialized.
+// Decoded struct is then validated with ValidateStruct.
 func KVMapToStruct(in map[string]interface{}, prefix string, out interface{}) error {
 	var inVal interface{}
 
@@ -342,6 +339,10 @@ func KVMapToStruct(in map[string]interface{}, prefix string, out interface{}) er
 				flattenOut[k] = cast.ToString(inVal)
 			case []int:
 				flattenOut[k] = cast.ToIntSlice(inVal)
+			case []string:
+				flattenOut[k] = cast.ToStringSlice(inVal)
+			case []bool:
+				flattenOut[k] = cast.ToBoolSlice(inVal)
 			case map[string]interface{}:
 				flattenOut[k] = inVal
 			default:
@@ -352,25 +353,26 @@ func KVMapToStruct(in map[string]interface{}, prefix string, out interface{}) er
 
 	// Convert struct's flatten map to struct
 	err := FlattenMapToStruct(flattenOut, out)
-	//fmt.Println(err, out)
-	return err
+	if err != nil {
+		return err
+	}
+
+	// Check validate tags and Validator implementations
+	return ValidateStruct(out, prefix)
 }
 
 // KVMapToMap converts a KV map to nested map.
 func KVMapToMap(in map[string]interface{}, prefix string) (map[string]interface{}, error) {
-	var keys []string
 	out := make(map[string]interface{})
 	key := ""
 	parent := ""
-	count := 1
+	slicePath := ""
+	count := 0
 	slice := false
 
-	// Create a slice only containing in map's keys to be sorted
-	for k := range in {
-		keys = append(keys, k)
-	}
-
-	sort.Strings(keys)
+	// Sort keys naturally so that slice elements come in index order
+	// (Hosts/2 before Hosts/10) right after each other
+	keys := sortedKeys(in, true)
 
 	// Loop sorted map
 	for _, k := range keys {
@@ -396,18 +398,22 @@ func KVMapToMap(in map[string]interface{}, prefix string) (map[string]interface{
 			// Get the last key that will be assigned a value
 			key = childs[len(childs)-1]
 
-			// Check if key is an elem of slice(0, 1, 3 etc.)
+			// Check if key is an elem of slice(0, 1, 3 etc.): the first
+			// elem of a new slice or the next elem of the current one
 			pos, err := strconv.Atoi(key)
-			if err == nil && pos == count {
+			path := strings.Join(childs[:len(childs)-1], "/")
+			if err == nil && len(childs) > 1 && (pos == 0 || (slice && pos == count && path == slicePath)) {
 				// Get parent of key ==> slice field
 				parent = childs[len(childs)-2]
+				slicePath = path
 				slice = true
-				count = count + 1
+				count = pos + 1
 			} else {
 				// Reinitialize variables for slice case
 				slice = false
 				count = 0
 				parent = ""
+				slicePath = ""
 			}
 
 			// In case of slice, remove key + its parents (slice itself)
@@ -529,7 +535,7 @@ func FlattenMapToStruct(in map[string]interface{}, out interface{}) error {
 			case map[string]interface{}:
 				v.Set(reflect.ValueOf(cast.ToStringMap(in[field.Name])))
 			default:
-				return fmt.Errorf("type error not supported %s", t)
+				return fmt.Errorf("type error not supported %T at field %s", t, field.Name)
 			}
 		}
 	}
@@ -538,3 +544,112 @@ func FlattenMapToStruct(in map[string]interface{}, out interface{}) error {
 }
 
 //////////////////////// PRIVATE FUNCTIONS ///////////////////////
+
+// inputToMap converts a Go struct, a pointer to a Go struct
+// or a map[string]interface{} to a nested map.
+func inputToMap(input interface{}) (map[string]interface{}, error) {
+	v := reflect.Indirect(reflect.ValueOf(input))
+
+	switch v.Kind() {
+	case reflect.Struct:
+		return structs.Map(input), nil
+	case reflect.Map:
+		m, ok := input.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("Error: input is not a map[string]interface{}")
+		}
+		return m, nil
+	}
+
+	return nil, fmt.Errorf("Error: input is neither a Go struct nor a map[string]interface{}")
+}
+
+// inputToKVPairs converts the input to Consul kv pairs under kvmapstruct path.
+// It also returns the secret fields of the input if it is a Go struct.
+// Values are not encrypted yet.
+func (kms *KVMapStruct) inputToKVPairs(input interface{}) (consul.KVPairs, []structField, error) {
+	m, err := inputToMap(input)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pairs, err := kms.MapToKVPairs(m, kms.Path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return pairs, secretFields(reflect.TypeOf(input), kms.Path), nil
+}
+
+// listKVPairs gets all consul kv pairs under kvmapstruct path.
+// Folder keys and keys only sharing the path as string prefix
+// (path "test" and key "test2/key1" for example) are skipped.
+func (kms *KVMapStruct) listKVPairs() (consul.KVPairs, error) {
+	pairs, _, err := kms.listPrefix(kms.Path, nil)
+
+	return pairs, err
+}
+
+// listPrefix gets all consul kv pairs under prefix with query options q.
+// Folder keys and keys only sharing the prefix as string prefix are skipped.
+func (kms *KVMapStruct) listPrefix(prefix string, q *consul.QueryOptions) (consul.KVPairs, *consul.QueryMeta, error) {
+	var out consul.KVPairs
+
+	pairs, meta, err := kms.Client.KV().List(prefix, kms.queryOptions(q))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, kv := range pairs {
+		if strings.HasSuffix(kv.Key, "/") || !kvpath.InPath(kv.Key, prefix) {
+			continue
+		}
+
+		out = append(out, kv)
+	}
+
+	return out, meta, nil
+}
+
+// sortedKeys returns the keys of m sorted. If natural is true,
+// keys are compared path segment by path segment and numeric
+// segments are compared as numbers.
+func sortedKeys(m map[string]interface{}, natural bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	if natural {
+		sort.Slice(keys, func(i, j int) bool {
+			return naturalLess(keys[i], keys[j])
+		})
+	} else {
+		sort.Strings(keys)
+	}
+
+	return keys
+}
+
+// naturalLess compares keys a and b path segment by path segment.
+// Numeric segments are compared as numbers, others as strings.
+func naturalLess(a, b string) bool {
+	as := strings.Split(a, "/")
+	bs := strings.Split(b, "/")
+
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		if as[i] == bs[i] {
+			continue
+		}
+
+		ai, aerr := strconv.Atoi(as[i])
+		bi, berr := strconv.Atoi(bs[i])
+		if aerr == nil && berr == nil && ai != bi {
+			return ai < bi
+		}
+
+		return as[i] < bs[i]
+	}
+
+	return len(as) < len(bs)
+}
@@ -175,6 +175,63 @@ func TestMapToKVPairs(t *testing.T) {
 
 }
 
+func TestMapToKVPairsOrder(t *testing.T) {
+	testCases := []struct {
+		name    string
+		natural bool
+		output  []string
+	}{
+		{
+			"StringOrder",
+			false,
+			[]string{"test/DB/Host", "test/Hosts/0", "test/Hosts/1", "test/Hosts/10", "test/Hosts/2", "test/Hosts/3", "test/Hosts/4", "test/Hosts/5", "test/Hosts/6", "test/Hosts/7", "test/Hosts/8", "test/Hosts/9", "test/key1"},
+		},
+		{
+			"NaturalOrder",
+			true,
+			[]string{"test/DB/Host", "test/Hosts/0", "test/Hosts/1", "test/Hosts/2", "test/Hosts/3", "test/Hosts/4", "test/Hosts/5", "test/Hosts/6", "test/Hosts/7", "test/Hosts/8", "test/Hosts/9", "test/Hosts/10", "test/key1"},
+		},
+	}
+
+	input := map[string]interface{}{
+		"key1":  "val1",
+		"Hosts": []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10},
+		"DB": map[string]interface{}{
+			"Host": "localhost",
+		},
+	}
+
+	kms, err := NewKVMapStruct("", "", "test")
+	if err != nil {
+		t.Errorf("%s", err.Error())
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			kms.NaturalSort = tc.natural
+
+			// Order must not change between calls
+			for i := 0; i < 5; i++ {
+				var keys []string
+
+				o, err := kms.MapToKVPairs(input, "test")
+				if err != nil {
+					t.Fatalf("%s", err)
+				}
+
+				for _, kv := range o {
+					keys = append(keys, kv.Key)
+				}
+
+				if !reflect.DeepEqual(keys, tc.output) {
+					t.Fatalf("\nwant:\n%v\nhave:\n%v", tc.output, keys)
+				}
+			}
+		})
+	}
+
+}
+
 func TestMapToConsulKV(t *testing.T) {
 	testCases := []struct {
 		name   string
@@ -436,6 +493,32 @@ func TestKVMapToMap(t *testing.T) {
 				},
 			},
 		},
+		{
+			"ConsecutiveAndLongSlices",
+			"",
+			map[string]interface{}{
+				"key1/0":  "a",
+				"key1/1":  "b",
+				"key2/0":  1,
+				"key3/0":  "0",
+				"key3/1":  "1",
+				"key3/2":  "2",
+				"key3/3":  "3",
+				"key3/4":  "4",
+				"key3/5":  "5",
+				"key3/6":  "6",
+				"key3/7":  "7",
+				"key3/8":  "8",
+				"key3/9":  "9",
+				"key3/10": "10",
+				"key3/11": "11",
+			},
+			map[string]interface{}{
+				"key1": []string{"a", "b"},
+				"key2": []int{1},
+				"key3": []string{"0", "1", "2", "3", "4", "5", "6", "7", "8", "9", "10", "11"},
+			},
+		},
 	}
 
 	for _, tc := range testCases {
@@ -556,6 +639,8 @@ func TestKVMapToStruct(t *testing.T) {
 		Key2 int
 		Key3 []int
 		Key4 *STChildLevel1
+		Key5 []string
+		Key6 []bool
 	}
 
 	testCases := []struct {
@@ -596,6 +681,29 @@ func TestKVMapToStruct(t *testing.T) {
 						},
 					},
 				},
+				Key5: []string{},
+				Key6: []bool{},
+			},
+		},
+		{
+			"StringAndBoolSlices",
+			"test",
+			map[string]interface{}{
+				"test/Key5/0": "one",
+				"test/Key5/1": "two",
+				"test/Key6/0": "true",
+				"test/Key6/1": "false",
+			},
+			&ST{
+				Key3: []int{},
+				Key4: &STChildLevel1{
+					Key42: map[string]interface{}{},
+					Key43: &STChildLevel2{
+						Key431: map[string]interface{}{},
+					},
+				},
+				Key5: []string{"one", "two"},
+				Key6: []bool{true, false},
 			},
 		},
 	}
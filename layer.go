@@ -0,0 +1,295 @@
+package kvmapstruct
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/uthng/kvmapstruct/internal/kvpath"
+)
+
+// Layer is a source of kv pairs for layered decoding.
+// Keys of a layer are relative to its prefix, so that
+// config/global/DB/Host and config/prod/DB/Host both set DB/Host.
+type Layer struct {
+	// Name identifies the layer in sources
+	Name string
+	// Prefix is the parent key of the layer's keys
+	Prefix string
+	// KVMap contains the kv pairs of local layers.
+	// If nil, the kv pairs under Prefix are read from Consul.
+	KVMap map[string]interface{}
+	// origins are the original names of relative keys, if they are
+	// not keys under Prefix (environment variable names for example)
+	origins map[string]string
+	// indexes are the Consul modify indexes of the full keys
+	indexes map[string]uint64
+	// empty are the relative keys of the slices the layer
+	// redefines with no element
+	empty map[string]bool
+	// kind is the kind of the layer's source
+	kind SourceKind
+}
+
+// SourceKind is the kind of source a value comes from.
+type SourceKind string
+
+// Kinds of sources. Values of local layers created with MapLayer
+// have no kind.
+const (
+	SourceConsul  SourceKind = "consul"
+	SourceFile    SourceKind = "file"
+	SourceEnv     SourceKind = "env"
+	SourceFlag    SourceKind = "flag"
+	SourceDefault SourceKind = "default"
+)
+
+// Source tells where the final value of a key comes from.
+type Source struct {
+	// Layer is the name of the layer
+	Layer string `json:"layer"`
+	// Kind is the kind of the layer's source
+	Kind SourceKind `json:"kind,omitempty"`
+	// Key is the full key in the layer: a Consul key, an environment
+	// variable name, a flag name or a key of a local layer
+	Key string `json:"key"`
+	// Index is the Consul modify index of the key
+	Index uint64 `json:"index,omitempty"`
+}
+
+// ConsulLayer creates a layer reading the kv pairs under prefix from Consul.
+func ConsulLayer(prefix string) Layer {
+	return Layer{
+		Name:   "consul:" + prefix,
+		Prefix: prefix,
+		kind:   SourceConsul,
+	}
+}
+
+// MapLayer creates a layer from a local KV map whose keys are under prefix.
+func MapLayer(name string, kvmap map[string]interface{}, prefix string) Layer {
+	return Layer{
+		Name:   name,
+		Prefix: prefix,
+		KVMap:  kvmap,
+	}
+}
+
+// FileLayer creates a layer from a local JSON file containing a nested map.
+func FileLayer(filename string) (Layer, error) {
+	var m map[string]interface{}
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return Layer{}, err
+	}
+
+	err = json.Unmarshal(data, &m)
+	if err != nil {
+		return Layer{}, err
+	}
+
+	l := MapLayer("file:"+filename, MapToKVMap(m, ""), "")
+	l.kind = SourceFile
+
+	return l, nil
+}
+
+// DefaultLayer creates a layer from the default tags of the fields of
+// the Go struct st. It is meant to be the first layer, so that any other
+// source overrides defaults. st argument can be a Go struct or a pointer
+// to a Go struct, initialized or not.
+func DefaultLayer(st interface{}) Layer {
+	l := Layer{
+		Name:    "default",
+		KVMap:   make(map[string]interface{}),
+		origins: make(map[string]string),
+		kind:    SourceDefault,
+	}
+
+	for _, f := range structFields(reflect.TypeOf(st), "") {
+		d, ok := f.Field.Tag.Lookup(defaultTagName)
+		if !ok {
+			continue
+		}
+
+		if f.Field.Type.Kind() == reflect.Slice {
+			for i, e := range splitList(d) {
+				k := f.Key + "/" + strconv.Itoa(i)
+				l.KVMap[k] = e
+				l.origins[k] = f.Path
+			}
+			continue
+		}
+
+		l.KVMap[f.Key] = d
+		l.origins[f.Key] = f.Path
+	}
+
+	return l
+}
+
+// LayersToStruct decodes a Go struct from several layers. Later layers
+// override earlier ones key by key, except slices which are replaced
+// as a whole. It returns the source of each final key, relative to
+// layer prefixes, with the modify indexes of Consul keys. Secret values
+// of Consul layers are decrypted and validation errors cite the key of
+// the layer the value comes from.
+// Out argument follows the same rules as for KVMapToStruct.
+func (kms *KVMapStruct) LayersToStruct(out interface{}, layers ...Layer) (map[string]Source, error) {
+	resolved := make([]Layer, 0, len(layers))
+
+	for _, l := range layers {
+		if l.KVMap == nil {
+			m, indexes, err := kms.listKVMap(l.Prefix)
+			if err != nil {
+				return nil, err
+			}
+
+			err = kms.decryptKVMap(m, secretFields(reflect.TypeOf(out), l.Prefix))
+			if err != nil {
+				return nil, err
+			}
+
+			l.KVMap = m
+			l.indexes = indexes
+			l.kind = SourceConsul
+		}
+
+		resolved = append(resolved, l)
+	}
+
+	m, sources := MergeLayers(resolved, out)
+
+	err := KVMapToStruct(m, "", out)
+	if errs, ok := err.(ValidationErrors); ok {
+		for _, e := range errs {
+			if s, ok := sources[e.Key]; ok {
+				e.Key = s.Key
+			}
+		}
+	}
+
+	return sources, err
+}
+
+// MergeLayers merges local layers into a single KV map whose keys are
+// relative to layer prefixes. Later layers override earlier ones key
+// by key, except slice fields of the Go struct st which are replaced
+// as a whole. st can be nil. Layers with a nil KVMap are skipped.
+// It also returns the source of each key of the merged map.
+func MergeLayers(layers []Layer, st interface{}) (map[string]interface{}, map[string]Source) {
+	var slices []structField
+
+	out := make(map[string]interface{})
+	sources := make(map[string]Source)
+
+	for _, f := range structFields(reflect.TypeOf(st), "") {
+		if f.Field.Type.Kind() == reflect.Slice {
+			slices = append(slices, f)
+		}
+	}
+
+	for _, l := range layers {
+		m := make(map[string]interface{})
+
+		for k, v := range l.KVMap {
+			if strings.HasSuffix(k, "/") || !kvpath.InPath(k, l.Prefix) || k == l.Prefix {
+				continue
+			}
+
+			m[relativeKey(k, l.Prefix)] = v
+		}
+
+		// Remove slices of previous layers redefined by this one
+		for _, f := range slices {
+			redefined := l.empty[f.Key]
+			for k := range m {
+				if f.matchKey(k) {
+					redefined = true
+					break
+				}
+			}
+
+			if !redefined {
+				continue
+			}
+
+			for k := range out {
+				if f.matchKey(k) {
+					delete(out, k)
+					delete(sources, k)
+				}
+			}
+		}
+
+		for k, v := range m {
+			origin, ok := l.origins[k]
+			if !ok {
+				origin = joinKey(l.Prefix, k)
+			}
+
+			out[k] = v
+			sources[k] = Source{
+				Layer: l.Name,
+				Kind:  l.kind,
+				Key:   origin,
+				Index: l.indexes[joinKey(l.Prefix, k)],
+			}
+		}
+	}
+
+	return out, sources
+}
+
+// overlayLayer returns a copy of the KV map in, whose keys are under
+// prefix, overridden by the keys of the layer l.
+func overlayLayer(in map[string]interface{}, prefix string, st interface{}, l Layer) map[string]interface{} {
+	out := make(map[string]interface{})
+
+	m, _ := MergeLayers([]Layer{MapLayer("", in, prefix), l}, st)
+	for k, v := range m {
+		out[joinKey(prefix, k)] = v
+	}
+
+	return out
+}
+
+// listKVMap gets all consul kv pairs under prefix as a KV map,
+// with the modify index of each key.
+func (kms *KVMapStruct) listKVMap(prefix string) (map[string]interface{}, map[string]uint64, error) {
+	m := make(map[string]interface{})
+	indexes := make(map[string]uint64)
+
+	pairs, _, err := kms.listPrefix(prefix, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, kv := range pairs {
+		m[kv.Key] = string(kv.Value)
+		indexes[kv.Key] = kv.ModifyIndex
+	}
+
+	return m, indexes, nil
+}
+
+// relativeKey removes prefix from key.
+func relativeKey(key, prefix string) string {
+	if prefix == "" {
+		return key
+	}
+
+	return strings.TrimPrefix(key, strings.TrimSuffix(prefix, "/")+"/")
+}
+
+// joinKey joins prefix and a relative key.
+func joinKey(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+
+	return strings.TrimSuffix(prefix, "/") + "/" + key
+}
@@ -0,0 +1,193 @@
+package kvmapstruct
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	consul "github.com/hashicorp/consul/api"
+)
+
+type layerDB struct {
+	Host string
+	Port int
+}
+
+type layerST struct {
+	Env     string
+	Workers int
+	Hosts   []string
+	DB      *layerDB
+}
+
+func TestMergeLayers(t *testing.T) {
+	testCases := []struct {
+		name    string
+		layers  []Layer
+		output  map[string]interface{}
+		sources map[string]Source
+	}{
+		{
+			"GlobalEnvService",
+			[]Layer{
+				MapLayer("global", map[string]interface{}{
+					"config/global/Env":     "dev",
+					"config/global/Workers": "1",
+					"config/global/Hosts/0": "host1",
+					"config/global/Hosts/1": "host2",
+					"config/global/DB/Host": "localhost",
+					"config/global/DB/Port": "5432",
+				}, "config/global"),
+				MapLayer("env", map[string]interface{}{
+					"config/prod/Env":     "prod",
+					"config/prod/Hosts/0": "prod1",
+					"config/prod/DB/Host": "db.prod",
+					"config/prod2/Env":    "other",
+				}, "config/prod"),
+				MapLayer("service", map[string]interface{}{
+					"config/prod/api/Workers": "8",
+				}, "config/prod/api"),
+			},
+			map[string]interface{}{
+				"Env":     "prod",
+				"Workers": "8",
+				"Hosts/0": "prod1",
+				"DB/Host": "db.prod",
+				"DB/Port": "5432",
+			},
+			map[string]Source{
+				"Env":     {Layer: "env", Key: "config/prod/Env"},
+				"Workers": {Layer: "service", Key: "config/prod/api/Workers"},
+				"Hosts/0": {Layer: "env", Key: "config/prod/Hosts/0"},
+				"DB/Host": {Layer: "env", Key: "config/prod/DB/Host"},
+				"DB/Port": {Layer: "global", Key: "config/global/DB/Port"},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			o, sources := MergeLayers(tc.layers, layerST{})
+
+			if !reflect.DeepEqual(o, tc.output) {
+				t.Errorf("\nwant:\n%v\nhave:\n%v", tc.output, o)
+			}
+
+			if !reflect.DeepEqual(sources, tc.sources) {
+				t.Errorf("\nwant:\n%v\nhave:\n%v", tc.sources, sources)
+			}
+		})
+	}
+
+}
+
+func TestLayersToStruct(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kvmapstruct")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "local.json")
+	err = ioutil.WriteFile(filename, []byte(`{"Workers": 16, "Hosts": ["local1", "local2"]}`), 0600)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	fileLayer, err := FileLayer(filename)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	testCases := []struct {
+		name    string
+		stored  map[string]interface{}
+		layers  []Layer
+		output  *layerST
+		sources map[string]Source
+	}{
+		{
+			"ConsulAndFileLayers",
+			map[string]interface{}{
+				"test/global/Env":     "dev",
+				"test/global/Workers": "1",
+				"test/global/DB/Host": "localhost",
+				"test/prod/Env":       "prod",
+				"test/prod/DB/Port":   "5432",
+			},
+			[]Layer{
+				ConsulLayer("test/global"),
+				ConsulLayer("test/prod"),
+				fileLayer,
+			},
+			&layerST{
+				Env:     "prod",
+				Workers: 16,
+				Hosts:   []string{"local1", "local2"},
+				DB: &layerDB{
+					Host: "localhost",
+					Port: 5432,
+				},
+			},
+			map[string]Source{
+				"Env":     {Layer: "consul:test/prod", Kind: SourceConsul, Key: "test/prod/Env"},
+				"Workers": {Layer: "file:" + filename, Kind: SourceFile, Key: "Workers"},
+				"Hosts/0": {Layer: "file:" + filename, Kind: SourceFile, Key: "Hosts/0"},
+				"Hosts/1": {Layer: "file:" + filename, Kind: SourceFile, Key: "Hosts/1"},
+				"DB/Host": {Layer: "consul:test/global", Kind: SourceConsul, Key: "test/global/DB/Host"},
+				"DB/Port": {Layer: "consul:test/prod", Kind: SourceConsul, Key: "test/prod/DB/Port"},
+			},
+		},
+	}
+
+	kms, err := NewKVMapStruct("localhost:8500", "adf4238a-882b-9ddc-4a9d-5b6758e4159e", "test")
+	if err != nil {
+		t.Errorf("%s", err.Error())
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			st := &layerST{DB: &layerDB{}}
+
+			// Insert data in to consul
+			for k, v := range tc.stored {
+				kv := &consul.KVPair{
+					Key:   k,
+					Value: []byte(v.(string)),
+				}
+
+				_, err := kms.Client.KV().Put(kv, nil)
+				if err != nil {
+					t.Errorf("%s", err)
+				}
+			}
+
+			sources, err := kms.LayersToStruct(st, tc.layers...)
+			if err != nil {
+				t.Errorf("%s", err)
+			}
+
+			if !reflect.DeepEqual(st, tc.output) {
+				t.Errorf("\nwant:\n%v\nhave:\n%v", tc.output, st)
+			}
+
+			// Modify indexes of Consul keys are only known once stored
+			for k, s := range sources {
+				if (s.Kind == SourceConsul) != (s.Index > 0) {
+					t.Errorf("wrong modify index of %s: %d", k, s.Index)
+				}
+				s.Index = 0
+				sources[k] = s
+			}
+
+			if !reflect.DeepEqual(sources, tc.sources) {
+				t.Errorf("\nwant:\n%v\nhave:\n%v", tc.sources, sources)
+			}
+
+			kms.Client.KV().DeleteTree("test", nil)
+		})
+	}
+
+}
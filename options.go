@@ -0,0 +1,139 @@
+package kvmapstruct
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	consul "github.com/hashicorp/consul/api"
+)
+
+// ReadOptions are the Consul query options of reads.
+// The zero value is Consul's default consistency mode
+// with the datacenter, namespace, partition and token
+// of the client.
+type ReadOptions struct {
+	// Consistent forces the leader to confirm it still is the
+	// leader before answering, at the cost of a round trip
+	Consistent bool
+	// Stale allows any server to answer, even without leader
+	Stale bool
+	// MaxStaleness, if set with Stale, rejects answers of servers
+	// whose last contact with the leader is older
+	MaxStaleness time.Duration
+	// Datacenter overrides the datacenter of the client
+	Datacenter string
+	// Namespace overrides the namespace of the client (Consul Enterprise)
+	Namespace string
+	// Partition overrides the admin partition of the client (Consul Enterprise)
+	Partition string
+	// Token overrides the ACL token of the client
+	Token string
+}
+
+// QueryMeta is the Consul metadata of a read.
+type QueryMeta struct {
+	// LastIndex is the Raft index of the last change of the read keys
+	LastIndex uint64
+	// KnownLeader is false if the server answering had no leader
+	KnownLeader bool
+	// LastContact is the time since the server answering last
+	// contacted the leader. It is 0 if it is the leader.
+	LastContact time.Duration
+}
+
+// ConsulKVToStructWithOptions is ConsulKVToStruct reading with the
+// query options opts. It returns the metadata of the read. opts can
+// be nil for the default options.
+func (kms *KVMapStruct) ConsulKVToStructWithOptions(out interface{}, opts *ReadOptions) (*QueryMeta, error) {
+	m, meta, err := kms.listWithOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	err = kms.decryptKVMap(m, secretFields(reflect.TypeOf(out), kms.Path))
+	if err != nil {
+		return nil, err
+	}
+
+	if kms.EnvOverlay != nil {
+		m = kms.EnvOverlay.Overlay(m, kms.Path, out)
+	}
+
+	err = KVMapToStruct(m, kms.Path, out)
+	if err != nil {
+		return nil, err
+	}
+
+	return meta, nil
+}
+
+// ConsulKVToMapWithOptions is ConsulKVToMap reading with the query
+// options opts. It returns the metadata of the read. opts can be nil
+// for the default options.
+func (kms *KVMapStruct) ConsulKVToMapWithOptions(opts *ReadOptions) (map[string]interface{}, *QueryMeta, error) {
+	m, meta, err := kms.listWithOptions(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	out, err := KVMapToMap(m, kms.Path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return out, meta, nil
+}
+
+// listWithOptions gets all consul keys from kvmapstruct path
+// as a KV map with the query options opts.
+func (kms *KVMapStruct) listWithOptions(opts *ReadOptions) (map[string]interface{}, *QueryMeta, error) {
+	m := make(map[string]interface{})
+
+	q, err := opts.queryOptions()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pairs, qm, err := kms.Client.KV().List(kms.Path, kms.queryOptions(q))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	meta := &QueryMeta{
+		LastIndex:   qm.LastIndex,
+		KnownLeader: qm.KnownLeader,
+		LastContact: qm.LastContact,
+	}
+
+	if opts != nil && opts.Stale && opts.MaxStaleness > 0 && meta.LastContact > opts.MaxStaleness {
+		return nil, nil, fmt.Errorf("stale read: last contact with leader %s ago exceeds %s", meta.LastContact, opts.MaxStaleness)
+	}
+
+	for _, kv := range pairs {
+		m[kv.Key] = string(kv.Value)
+	}
+
+	return m, meta, nil
+}
+
+// queryOptions converts read options to consul query options.
+// Nil read options are nil query options.
+func (opts *ReadOptions) queryOptions() (*consul.QueryOptions, error) {
+	if opts == nil {
+		return nil, nil
+	}
+
+	if opts.Consistent && opts.Stale {
+		return nil, fmt.Errorf("read options: consistent and stale modes are exclusive")
+	}
+
+	return &consul.QueryOptions{
+		RequireConsistent: opts.Consistent,
+		AllowStale:        opts.Stale,
+		Datacenter:        opts.Datacenter,
+		Namespace:         opts.Namespace,
+		Partition:         opts.Partition,
+		Token:             opts.Token,
+	}, nil
+}
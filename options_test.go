@@ -0,0 +1,74 @@
+package kvmapstruct
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestConsulKVToStructWithOptions(t *testing.T) {
+	type config struct {
+		Env   string
+		Hosts []string
+	}
+
+	testCases := []struct {
+		name string
+		opts *ReadOptions
+		err  bool
+	}{
+		{"Default", nil, false},
+		{"Consistent", &ReadOptions{Consistent: true}, false},
+		{"Stale", &ReadOptions{Stale: true, MaxStaleness: time.Minute}, false},
+		{"ConsistentAndStale", &ReadOptions{Consistent: true, Stale: true}, true},
+		{"UnknownDatacenter", &ReadOptions{Datacenter: "unknown"}, true},
+	}
+
+	kms, err := NewKVMapStruct("localhost:8500", "adf4238a-882b-9ddc-4a9d-5b6758e4159e", "options")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	in := config{Env: "prod", Hosts: []string{"host1", "host2"}}
+
+	err = kms.StructToConsulKV(in)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			out := &config{}
+
+			meta, err := kms.ConsulKVToStructWithOptions(out, tc.opts)
+			if tc.err {
+				if err == nil {
+					t.Fatalf("no error")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("%s", err)
+			}
+
+			if !reflect.DeepEqual(*out, in) {
+				t.Errorf("\nwant:\n%v\nhave:\n%v", in, *out)
+			}
+
+			if meta.LastIndex == 0 || !meta.KnownLeader {
+				t.Errorf("wrong query meta: %+v", meta)
+			}
+
+			m, meta, err := kms.ConsulKVToMapWithOptions(tc.opts)
+			if err != nil {
+				t.Fatalf("%s", err)
+			}
+
+			if m["Env"] != "prod" || meta.LastIndex == 0 {
+				t.Errorf("wrong map %v or query meta %+v", m, meta)
+			}
+		})
+	}
+
+}
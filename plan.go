@@ -0,0 +1,259 @@
+package kvmapstruct
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	consul "github.com/hashicorp/consul/api"
+)
+
+// OpVerb is the kind of write an operation executes.
+type OpVerb string
+
+const (
+	// OpPut writes the value whatever the key state is.
+	OpPut OpVerb = "put"
+	// OpDelete deletes the key.
+	OpDelete OpVerb = "delete"
+	// OpCAS writes the value only if the key ModifyIndex is still Index.
+	// Index 0 means the key must not exist yet.
+	OpCAS OpVerb = "cas"
+)
+
+// Operation is a single write to Consul.
+// Values of sensitive operations are replaced by Redacted when
+// the plan or the operation is printed or marshaled to JSON.
+type Operation struct {
+	Verb      OpVerb `json:"verb"`
+	Key       string `json:"key"`
+	Value     string `json:"value,omitempty"`
+	Index     uint64 `json:"index,omitempty"`
+	Sensitive bool   `json:"sensitive,omitempty"`
+}
+
+// operation has the same fields as Operation without its methods.
+type operation Operation
+
+// Plan is the ordered list of operations needed to write an input
+// to Consul. It can be reviewed, serialized to JSON and applied later.
+type Plan struct {
+	Path       string      `json:"path"`
+	Operations []Operation `json:"operations"`
+}
+
+// Plan computes the operations StructToConsulKV or MapToConsulKV
+// would execute to write the input under kvmapstruct path, without
+// writing anything to Consul. input argument can be a Go struct,
+// a pointer to a Go struct or a map[string]interface{}.
+//
+// Unchanged keys are skipped and the other ones are written with cas
+// operations pinned to the ModifyIndex read during planning, so that
+// applying the plan fails if Consul changed in the meantime.
+//
+// Secret fields are compared in clear text and their operations
+// contain encrypted values. Operations of secret fields and of fields
+// tagged with `kv:",sensitive"` are marked as sensitive.
+//
+// Plans are computed and applied in a single datacenter: ModifyIndexes
+// differ between datacenters. Plan and Apply are rejected if
+// Datacenters is set; use a KVMapStruct per datacenter instead.
+func (kms *KVMapStruct) Plan(input interface{}) (*Plan, error) {
+	if len(kms.Datacenters) > 0 {
+		return nil, errNotReplicated("plan")
+	}
+
+	desired, secrets, err := kms.inputToKVPairs(input)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := kms.listKVPairs()
+	if err != nil {
+		return nil, err
+	}
+
+	err = kms.decryptPairs(current, secrets)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := PlanKVPairs(current, desired)
+	plan.Path = kms.Path
+
+	sensitives := sensitiveFields(reflect.TypeOf(input), kms.Path)
+	for i, op := range plan.Operations {
+		plan.Operations[i].Sensitive = matchFields(sensitives, op.Key)
+
+		if !matchFields(secrets, op.Key) {
+			continue
+		}
+
+		v, err := encryptValue(kms.KeyProvider, []byte(op.Value))
+		if err != nil {
+			return nil, fmt.Errorf("error encrypting key %s: %s", op.Key, err)
+		}
+
+		plan.Operations[i].Value = string(v)
+	}
+
+	return plan, nil
+}
+
+// Apply executes the operations of a previously computed plan in order.
+// It stops at the first failing operation, including a cas operation
+// whose key was modified since the plan was computed. Plans with
+// redacted sensitive values, read from JSON, are rejected, as well as
+// plans applied with Datacenters set.
+func (kms *KVMapStruct) Apply(plan *Plan) error {
+	if len(kms.Datacenters) > 0 {
+		return errNotReplicated("apply")
+	}
+
+	for _, op := range plan.Operations {
+		if op.Sensitive && op.Value == Redacted {
+			return fmt.Errorf("redacted value at key %s: plan must be saved with UnredactedJSON", op.Key)
+		}
+	}
+
+	for _, op := range plan.Operations {
+		kv := &consul.KVPair{
+			Key:         op.Key,
+			Value:       []byte(op.Value),
+			ModifyIndex: op.Index,
+		}
+
+		switch op.Verb {
+		case OpPut:
+			_, err := kms.Client.KV().Put(kv, kms.writeOptions(nil))
+			if err != nil {
+				return err
+			}
+		case OpDelete:
+			_, err := kms.Client.KV().Delete(op.Key, kms.writeOptions(nil))
+			if err != nil {
+				return err
+			}
+		case OpCAS:
+			ok, _, err := kms.Client.KV().CAS(kv, kms.writeOptions(nil))
+			if err != nil {
+				return err
+			}
+
+			if !ok {
+				return fmt.Errorf("cas failed at key %s: key modified since index %d", op.Key, op.Index)
+			}
+		default:
+			return fmt.Errorf("unknown operation %s at key %s", op.Verb, op.Key)
+		}
+	}
+
+	return nil
+}
+
+// PlanKVPairs computes the operations needed to go from current
+// Consul kv pairs to desired ones. Operations are sorted by key.
+func PlanKVPairs(current, desired consul.KVPairs) *Plan {
+	plan := &Plan{
+		Operations: []Operation{},
+	}
+
+	cur := make(map[string]*consul.KVPair)
+	for _, kv := range current {
+		cur[kv.Key] = kv
+	}
+
+	for _, kv := range desired {
+		c, ok := cur[kv.Key]
+		if !ok {
+			plan.Operations = append(plan.Operations, Operation{Verb: OpCAS, Key: kv.Key, Value: string(kv.Value)})
+		} else if !bytes.Equal(c.Value, kv.Value) {
+			plan.Operations = append(plan.Operations, Operation{Verb: OpCAS, Key: kv.Key, Value: string(kv.Value), Index: c.ModifyIndex})
+		}
+	}
+
+	sort.Slice(plan.Operations, func(i, j int) bool {
+		return plan.Operations[i].Key < plan.Operations[j].Key
+	})
+
+	return plan
+}
+
+// Empty returns true if the plan has no operation.
+func (p *Plan) Empty() bool {
+	return len(p.Operations) == 0
+}
+
+// String implements fmt.Stringer by listing one operation per line.
+// Sensitive values are redacted.
+func (p *Plan) String() string {
+	var buf bytes.Buffer
+
+	for _, op := range p.Operations {
+		v := redact(op.Value, op.Sensitive)
+
+		switch op.Verb {
+		case OpDelete:
+			fmt.Fprintf(&buf, "%s %s\n", op.Verb, op.Key)
+		case OpCAS:
+			fmt.Fprintf(&buf, "%s %s = %s (index %d)\n", op.Verb, op.Key, v, op.Index)
+		default:
+			fmt.Fprintf(&buf, "%s %s = %s\n", op.Verb, op.Key, v)
+		}
+	}
+
+	return buf.String()
+}
+
+// MarshalJSON implements json.Marshaler by redacting sensitive values.
+func (op Operation) MarshalJSON() ([]byte, error) {
+	return json.Marshal(op.redacted())
+}
+
+// String implements fmt.Stringer by redacting sensitive values.
+func (op Operation) String() string {
+	return fmt.Sprintf("%v", op.redacted())
+}
+
+// GoString implements fmt.GoStringer by redacting sensitive values.
+func (op Operation) GoString() string {
+	o := op.redacted()
+
+	return fmt.Sprintf("kvmapstruct.Operation{Verb:%q, Key:%q, Value:%q, Index:0x%x, Sensitive:%t}", o.Verb, o.Key, o.Value, o.Index, o.Sensitive)
+}
+
+// redacted returns the fields of the operation with sensitive values redacted.
+func (op Operation) redacted() operation {
+	o := operation(op)
+
+	if o.Sensitive && o.Value != "" {
+		o.Value = Redacted
+	}
+
+	return o
+}
+
+// JSON renders the plan as an indented JSON document for review.
+// Sensitive values are redacted: use UnredactedJSON to save a plan
+// to be applied later.
+func (p *Plan) JSON() ([]byte, error) {
+	return json.MarshalIndent(p, "", "  ")
+}
+
+// UnredactedJSON renders the plan as an indented JSON document with
+// values kept as is, so that it can be read back with encoding/json
+// into a Plan to be applied. Secret values are encrypted but other
+// sensitive ones are in clear text.
+func (p *Plan) UnredactedJSON() ([]byte, error) {
+	ops := make([]operation, len(p.Operations))
+	for i, op := range p.Operations {
+		ops[i] = operation(op)
+	}
+
+	return json.MarshalIndent(struct {
+		Path       string      `json:"path"`
+		Operations []operation `json:"operations"`
+	}{p.Path, ops}, "", "  ")
+}
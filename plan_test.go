@@ -0,0 +1,171 @@
+package kvmapstruct
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	consul "github.com/hashicorp/consul/api"
+)
+
+func TestPlanKVPairs(t *testing.T) {
+	testCases := []struct {
+		name    string
+		current consul.KVPairs
+		desired consul.KVPairs
+		output  []Operation
+	}{
+		{
+			"NoChange",
+			consul.KVPairs{
+				{Key: "test/key1", Value: []byte("val1"), ModifyIndex: 10},
+			},
+			consul.KVPairs{
+				{Key: "test/key1", Value: []byte("val1")},
+			},
+			[]Operation{},
+		},
+		{
+			"AddedAndModified",
+			consul.KVPairs{
+				{Key: "test/key1", Value: []byte("val1"), ModifyIndex: 10},
+				{Key: "test/key2", Value: []byte("1"), ModifyIndex: 11},
+				{Key: "test/key3", Value: []byte("val3"), ModifyIndex: 12},
+			},
+			consul.KVPairs{
+				{Key: "test/key4", Value: []byte("val4")},
+				{Key: "test/key2", Value: []byte("2")},
+				{Key: "test/key1", Value: []byte("val1")},
+			},
+			[]Operation{
+				{Verb: OpCAS, Key: "test/key2", Value: "2", Index: 11},
+				{Verb: OpCAS, Key: "test/key4", Value: "val4"},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			plan := PlanKVPairs(tc.current, tc.desired)
+
+			if !reflect.DeepEqual(plan.Operations, tc.output) {
+				t.Errorf("\nwant:\n%v\nhave:\n%v", tc.output, plan.Operations)
+			}
+
+			// Plan must survive a JSON round trip
+			data, err := plan.UnredactedJSON()
+			if err != nil {
+				t.Errorf("%s", err)
+			}
+
+			p := &Plan{}
+			err = json.Unmarshal(data, p)
+			if err != nil {
+				t.Errorf("%s", err)
+			}
+
+			if !reflect.DeepEqual(p, plan) {
+				t.Errorf("\nwant:\n%v\nhave:\n%v", plan, p)
+			}
+		})
+	}
+
+}
+
+func TestPlanApply(t *testing.T) {
+	testCases := []struct {
+		name   string
+		prefix string
+		stored map[string]interface{}
+		input  interface{}
+		output map[string]interface{}
+	}{
+		{
+			"MapPlan",
+			"test",
+			map[string]interface{}{
+				"test/key1": "val1",
+				"test/key2": "1",
+			},
+			map[string]interface{}{
+				"key1": "val1",
+				"key2": 2,
+				"key3": []int{1, 2},
+			},
+			map[string]interface{}{
+				"test/key1":   "val1",
+				"test/key2":   "2",
+				"test/key3/0": "1",
+				"test/key3/1": "2",
+			},
+		},
+	}
+
+	kms, err := NewKVMapStruct("localhost:8500", "adf4238a-882b-9ddc-4a9d-5b6758e4159e", "test")
+	if err != nil {
+		t.Errorf("%s", err.Error())
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			out := make(map[string]interface{})
+
+			kms.Path = tc.prefix
+
+			// Insert data in to consul
+			for k, v := range tc.stored {
+				kv := &consul.KVPair{
+					Key:   k,
+					Value: []byte(v.(string)),
+				}
+
+				_, err := kms.Client.KV().Put(kv, nil)
+				if err != nil {
+					t.Errorf("%s", err)
+				}
+			}
+
+			plan, err := kms.Plan(tc.input)
+			if err != nil {
+				t.Fatalf("%s", err)
+			}
+
+			// Planning must not write anything
+			pairs, _, err := kms.Client.KV().List(tc.prefix, nil)
+			if err != nil {
+				t.Errorf("%s", err)
+			}
+
+			if len(pairs) != len(tc.stored) {
+				t.Errorf("plan has written to consul: %d keys instead of %d", len(pairs), len(tc.stored))
+			}
+
+			err = kms.Apply(plan)
+			if err != nil {
+				t.Errorf("%s", err)
+			}
+
+			pairs, _, err = kms.Client.KV().List(tc.prefix, nil)
+			if err != nil {
+				t.Errorf("%s", err)
+			}
+
+			for _, kv := range pairs {
+				out[kv.Key] = string(kv.Value)
+			}
+
+			if !reflect.DeepEqual(out, tc.output) {
+				t.Errorf("\nwant:\n%s\nhave:\n%s", tc.output, out)
+			}
+
+			// Applying the same plan again must fail because of cas
+			err = kms.Apply(plan)
+			if err == nil {
+				t.Errorf("stale plan applied without error")
+			}
+
+			kms.Client.KV().DeleteTree(tc.prefix, nil)
+		})
+	}
+
+}
@@ -0,0 +1,165 @@
+package kvmapstruct
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// Provenance tells where the value of each field of a decoded Go struct
+// comes from. Keys are Go field paths: DB.Host for a field of a substruct,
+// Hosts for a whole slice and Labels[team] for a key of a map.
+type Provenance map[string]Source
+
+// ConsulKVToStructWithProvenance decodes a Go struct as ConsulKVToStruct
+// does, EnvOverlay included, and returns the provenance of its fields.
+// Fields with no key have no source. Out argument follows the same rules
+// as for KVMapToStruct.
+func (kms *KVMapStruct) ConsulKVToStructWithProvenance(out interface{}) (Provenance, error) {
+	layers := []Layer{
+		ConsulLayer(kms.Path),
+	}
+
+	if kms.EnvOverlay != nil {
+		layers = append(layers, kms.EnvOverlay.Layer(out))
+	}
+
+	sources, err := kms.LayersToStruct(out, layers...)
+	if sources == nil {
+		return nil, err
+	}
+
+	return FieldSources(sources, out), err
+}
+
+// FieldSources converts the sources of relative keys returned by
+// LayersToStruct and MergeLayers to the provenance of the fields of
+// the Go struct st. Keys matching no field are ignored. The source of
+// a slice is the key of the slice itself with the highest modify index
+// of its elements. st argument can be a Go struct or a pointer to a
+// Go struct, initialized or not.
+func FieldSources(sources map[string]Source, st interface{}) Provenance {
+	p := make(Provenance)
+	fields := structFields(reflect.TypeOf(st), "")
+
+	for k, s := range sources {
+		f, ok := findField(fields, k)
+		if !ok {
+			continue
+		}
+
+		switch f.Field.Type.Kind() {
+		case reflect.Slice:
+			// Element keys end with their index, except environment
+			// variables and flags setting the whole slice
+			if k != f.Key {
+				s.Key = strings.TrimSuffix(s.Key, strings.TrimPrefix(k, f.Key))
+			}
+
+			if prev, ok := p[f.Path]; ok && prev.Index > s.Index {
+				s.Index = prev.Index
+			}
+
+			p[f.Path] = s
+		case reflect.Map:
+			if k == f.Key {
+				continue
+			}
+
+			p[f.Path+"["+strings.TrimPrefix(k, f.Key+"/")+"]"] = s
+		default:
+			p[f.Path] = s
+		}
+	}
+
+	return p
+}
+
+// String returns a textual description of the source.
+func (s Source) String() string {
+	switch s.Kind {
+	case SourceConsul:
+		if s.Index > 0 {
+			return fmt.Sprintf("consul key %s (index %d)", s.Key, s.Index)
+		}
+		return "consul key " + s.Key
+	case SourceDefault:
+		return "default tag of " + s.Key
+	case SourceEnv:
+		return "environment variable " + s.Key
+	case SourceFlag:
+		return "flag " + s.Key
+	}
+
+	return fmt.Sprintf("%s key %s", s.Layer, s.Key)
+}
+
+// Explain renders the provenance as a text report with one line per
+// field path: the path, the value of the field in the decoded Go
+// struct st and its source. Fields of st with no source are reported
+// too. Values of sensitive fields are redacted. If st is nil, values
+// are not rendered.
+func (p Provenance) Explain(st interface{}) string {
+	var buf bytes.Buffer
+
+	values := make(map[string]string)
+	paths := make(map[string]bool)
+
+	for path := range p {
+		paths[path] = true
+	}
+
+	for _, f := range structFields(reflect.TypeOf(st), "") {
+		v, ok := f.value(reflect.ValueOf(st))
+		sensitive := f.Options.Has("sensitive") || f.Options.Has("secret")
+
+		if f.Field.Type.Kind() != reflect.Map {
+			paths[f.Path] = true
+			if ok && (v.Kind() != reflect.Ptr || !v.IsNil()) {
+				values[f.Path] = redact(fmt.Sprintf("%v", reflect.Indirect(v)), sensitive)
+			}
+			continue
+		}
+
+		// Map keys are only known from sources
+		for path := range p {
+			if !strings.HasPrefix(path, f.Path+"[") || !ok || v.IsNil() || v.Type().Key().Kind() != reflect.String {
+				continue
+			}
+
+			key := strings.TrimSuffix(strings.TrimPrefix(path, f.Path+"["), "]")
+			e := v.MapIndex(reflect.ValueOf(key))
+			if e.IsValid() {
+				values[path] = redact(fmt.Sprintf("%v", e), sensitive)
+			}
+		}
+	}
+
+	sorted := make([]string, 0, len(paths))
+	for path := range paths {
+		sorted = append(sorted, path)
+	}
+	sort.Strings(sorted)
+
+	w := tabwriter.NewWriter(&buf, 0, 4, 2, ' ', 0)
+
+	for _, path := range sorted {
+		source := "no source"
+		if s, ok := p[path]; ok {
+			source = s.String()
+		}
+
+		if st == nil {
+			fmt.Fprintf(w, "%s\t%s\n", path, source)
+		} else {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", path, values[path], source)
+		}
+	}
+
+	w.Flush()
+
+	return buf.String()
+}
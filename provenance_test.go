@@ -0,0 +1,169 @@
+package kvmapstruct
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	consul "github.com/hashicorp/consul/api"
+)
+
+type provenanceDB struct {
+	Host     string `default:"localhost"`
+	Port     int    `default:"5432"`
+	Password string `kv:",sensitive"`
+}
+
+type provenanceST struct {
+	Env     string
+	Workers int `default:"1"`
+	Hosts   []string
+	Labels  map[string]interface{}
+	DB      *provenanceDB
+}
+
+func TestFieldSources(t *testing.T) {
+	testCases := []struct {
+		name       string
+		sources    map[string]Source
+		provenance Provenance
+	}{
+		{
+			"AllKinds",
+			map[string]Source{
+				"Env":         {Layer: "consul:test", Kind: SourceConsul, Key: "test/Env", Index: 12},
+				"Hosts/0":     {Layer: "consul:test", Kind: SourceConsul, Key: "test/Hosts/0", Index: 14},
+				"Hosts/1":     {Layer: "consul:test", Kind: SourceConsul, Key: "test/Hosts/1", Index: 15},
+				"Labels/team": {Layer: "file:local.json", Kind: SourceFile, Key: "Labels/team"},
+				"Workers":     {Layer: "env", Kind: SourceEnv, Key: "APP_WORKERS"},
+				"DB/Host":     {Layer: "flags", Kind: SourceFlag, Key: "-db.host"},
+				"DB/Port":     {Layer: "default", Kind: SourceDefault, Key: "DB.Port"},
+				"Unknown":     {Layer: "consul:test", Kind: SourceConsul, Key: "test/Unknown", Index: 3},
+			},
+			Provenance{
+				"Env":          {Layer: "consul:test", Kind: SourceConsul, Key: "test/Env", Index: 12},
+				"Hosts":        {Layer: "consul:test", Kind: SourceConsul, Key: "test/Hosts", Index: 15},
+				"Labels[team]": {Layer: "file:local.json", Kind: SourceFile, Key: "Labels/team"},
+				"Workers":      {Layer: "env", Kind: SourceEnv, Key: "APP_WORKERS"},
+				"DB.Host":      {Layer: "flags", Kind: SourceFlag, Key: "-db.host"},
+				"DB.Port":      {Layer: "default", Kind: SourceDefault, Key: "DB.Port"},
+			},
+		},
+		{
+			"WholeSliceFromEnv",
+			map[string]Source{
+				"Hosts/0": {Layer: "env", Kind: SourceEnv, Key: "APP_HOSTS"},
+				"Hosts/1": {Layer: "env", Kind: SourceEnv, Key: "APP_HOSTS"},
+			},
+			Provenance{
+				"Hosts": {Layer: "env", Kind: SourceEnv, Key: "APP_HOSTS"},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := FieldSources(tc.sources, provenanceST{})
+
+			if !reflect.DeepEqual(p, tc.provenance) {
+				t.Errorf("\nwant:\n%v\nhave:\n%v", tc.provenance, p)
+			}
+		})
+	}
+
+}
+
+func TestProvenanceExplain(t *testing.T) {
+	os.Setenv("APP_WORKERS", "8")
+	defer os.Unsetenv("APP_WORKERS")
+
+	st := &provenanceST{DB: &provenanceDB{}}
+	layers := []Layer{
+		DefaultLayer(st),
+		MapLayer("global", map[string]interface{}{
+			"config/Env":         "dev",
+			"config/Hosts/0":     "host1",
+			"config/Labels/team": "core",
+			"config/DB/Password": "secret",
+		}, "config"),
+		NewEnvOverlay("APP_", "").Layer(st),
+	}
+
+	m, sources := MergeLayers(layers, st)
+
+	err := KVMapToStruct(m, "", st)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	output := `DB.Host       localhost   default tag of DB.Host
+DB.Password   [redacted]  global key config/DB/Password
+DB.Port       5432        default tag of DB.Port
+Env           dev         global key config/Env
+Hosts         [host1]     global key config/Hosts
+Labels[team]  core        global key config/Labels/team
+Workers       8           environment variable APP_WORKERS
+`
+
+	explain := FieldSources(sources, st).Explain(st)
+	if explain != output {
+		t.Errorf("\nwant:\n%s\nhave:\n%s", output, explain)
+	}
+
+}
+
+func TestConsulKVToStructWithProvenance(t *testing.T) {
+	kms, err := NewKVMapStruct("localhost:8500", "adf4238a-882b-9ddc-4a9d-5b6758e4159e", "test")
+	if err != nil {
+		t.Errorf("%s", err.Error())
+	}
+
+	stored := map[string]string{
+		"test/Env":     "prod",
+		"test/DB/Host": "db.prod",
+	}
+
+	for k, v := range stored {
+		_, err := kms.Client.KV().Put(&consul.KVPair{Key: k, Value: []byte(v)}, nil)
+		if err != nil {
+			t.Errorf("%s", err)
+		}
+	}
+	defer kms.Client.KV().DeleteTree("test", nil)
+
+	st := &provenanceST{DB: &provenanceDB{}}
+
+	p, err := kms.ConsulKVToStructWithProvenance(st)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	// Explaining the decoding does not change it
+	want := &provenanceST{DB: &provenanceDB{}}
+
+	err = kms.ConsulKVToStruct(want)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if !reflect.DeepEqual(st, want) {
+		t.Errorf("\nwant:\n%v\nhave:\n%v", want, st)
+	}
+
+	for path, key := range map[string]string{"Env": "test/Env", "DB.Host": "test/DB/Host"} {
+		kv, _, err := kms.Client.KV().Get(key, nil)
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+
+		s := Source{Layer: "consul:test", Kind: SourceConsul, Key: key, Index: kv.ModifyIndex}
+		if p[path] != s {
+			t.Errorf("\nwant:\n%v\nhave:\n%v", s, p[path])
+		}
+	}
+
+	if s, ok := p["DB.Port"]; ok {
+		t.Errorf("source of a field with no key: %v", s)
+	}
+
+}
@@ -0,0 +1,52 @@
+package kvmapstruct
+
+import (
+	"reflect"
+)
+
+// Redacted replaces the values of sensitive fields in all textual
+// outputs of this package: diff and plan renders, errors and dumps.
+const Redacted = "[redacted]"
+
+// sensitiveFields returns the fields of struct type t whose values
+// must not appear in textual outputs. They are the fields tagged with
+// `kv:",sensitive"` and the ones tagged with `kv:",secret"`.
+func sensitiveFields(t reflect.Type, prefix string) []structField {
+	var sensitives []structField
+
+	for _, f := range structFields(t, prefix) {
+		if f.Options.Has("sensitive") || f.Options.Has("secret") {
+			sensitives = append(sensitives, f)
+		}
+	}
+
+	return sensitives
+}
+
+// RedactKVMap returns a copy of a KV map in which the values of the
+// sensitive fields of the Go struct st are replaced by Redacted.
+// st argument can be a Go struct or a pointer to a Go struct,
+// initialized or not. It is intended to dump KV maps safely.
+func RedactKVMap(in map[string]interface{}, prefix string, st interface{}) map[string]interface{} {
+	out := make(map[string]interface{})
+	sensitives := sensitiveFields(reflect.TypeOf(st), prefix)
+
+	for k, v := range in {
+		if matchFields(sensitives, k) {
+			out[k] = Redacted
+		} else {
+			out[k] = v
+		}
+	}
+
+	return out
+}
+
+// redact returns Redacted instead of value if sensitive is true.
+func redact(value string, sensitive bool) string {
+	if sensitive {
+		return Redacted
+	}
+
+	return value
+}
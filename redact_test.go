@@ -0,0 +1,160 @@
+package kvmapstruct
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRedactKVMap(t *testing.T) {
+	type STChild struct {
+		Host     string
+		Password string `kv:",sensitive"`
+	}
+
+	type ST struct {
+		User   string
+		Token  string   `kv:",secret"`
+		Tokens []string `kv:",sensitive"`
+		DB     *STChild
+	}
+
+	testCases := []struct {
+		name   string
+		prefix string
+		input  map[string]interface{}
+		output map[string]interface{}
+	}{
+		{
+			"SensitiveAndSecretFields",
+			"test",
+			map[string]interface{}{
+				"test/User":        "user",
+				"test/Token":       "token",
+				"test/Tokens/0":    "token1",
+				"test/Tokens/1":    "token2",
+				"test/DB/Host":     "localhost",
+				"test/DB/Password": "pass",
+			},
+			map[string]interface{}{
+				"test/User":        "user",
+				"test/Token":       Redacted,
+				"test/Tokens/0":    Redacted,
+				"test/Tokens/1":    Redacted,
+				"test/DB/Host":     "localhost",
+				"test/DB/Password": Redacted,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			o := RedactKVMap(tc.input, tc.prefix, &ST{})
+
+			if !reflect.DeepEqual(o, tc.output) {
+				t.Errorf("\nwant:\n%s\nhave:\n%s", tc.output, o)
+			}
+		})
+	}
+
+}
+
+func TestRedactDiffAndPlan(t *testing.T) {
+	testCases := []struct {
+		name  string
+		diff  *KVDiff
+		plan  *Plan
+		value string
+	}{
+		{
+			"SensitiveEntry",
+			&KVDiff{
+				Path: "test",
+				Entries: []DiffEntry{
+					{Key: "test/Password", Type: DiffModified, Old: "oldpass", New: "newpass", Sensitive: true},
+				},
+			},
+			&Plan{
+				Path: "test",
+				Operations: []Operation{
+					{Verb: OpCAS, Key: "test/Password", Value: "newpass", Index: 10, Sensitive: true},
+				},
+			},
+			"pass",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := tc.diff.JSON()
+			if err != nil {
+				t.Fatalf("%s", err)
+			}
+
+			planData, err := tc.plan.JSON()
+			if err != nil {
+				t.Fatalf("%s", err)
+			}
+
+			opData, err := json.Marshal(tc.plan)
+			if err != nil {
+				t.Fatalf("%s", err)
+			}
+
+			outputs := []string{tc.diff.Unified(), string(data), tc.plan.String(), string(planData), string(opData)}
+
+			// Entries and operations printed with fmt
+			for _, format := range []string{"%v", "%+v", "%#v", "%s"} {
+				outputs = append(outputs,
+					fmt.Sprintf(format, tc.diff.Entries),
+					fmt.Sprintf(format, tc.diff.Entries[0]),
+					fmt.Sprintf(format, tc.plan.Operations),
+					fmt.Sprintf(format, tc.plan.Operations[0]),
+				)
+			}
+			for _, o := range outputs {
+				if strings.Contains(o, tc.value) {
+					t.Errorf("sensitive value leaked:\n%s", o)
+				}
+
+				if !strings.Contains(o, Redacted) {
+					t.Errorf("sensitive value not redacted:\n%s", o)
+				}
+			}
+
+			// Values must still be available programmatically
+			if tc.diff.Entries[0].New != "newpass" {
+				t.Errorf("diff entry value modified: %s", tc.diff.Entries[0].New)
+			}
+
+			data, err = tc.plan.UnredactedJSON()
+			if err != nil {
+				t.Fatalf("%s", err)
+			}
+
+			p := &Plan{}
+			err = json.Unmarshal(data, p)
+			if err != nil {
+				t.Fatalf("%s", err)
+			}
+
+			if !reflect.DeepEqual(p, tc.plan) {
+				t.Errorf("\nwant:\n%v\nhave:\n%v", tc.plan, p)
+			}
+
+			// Redacted plans can not be applied
+			err = json.Unmarshal(planData, p)
+			if err != nil {
+				t.Fatalf("%s", err)
+			}
+
+			err = (&KVMapStruct{}).Apply(p)
+			if err == nil || !strings.Contains(err.Error(), "redacted") {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+
+}
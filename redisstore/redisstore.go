@@ -0,0 +1,226 @@
+// Package redisstore implements kvmapstruct.Store with Redis, with one
+// of two layouts:
+//
+//   - LayoutKeys: one string key per KV path. The key app/DB/Host is
+//     the Redis key app/DB/Host.
+//   - LayoutHash: one hash per parent path. The key app/DB/Host is the
+//     field Host of the Redis hash app/DB.
+//
+// Prefixes are listed with SCAN and kv pairs are saved atomically
+// with MULTI/EXEC.
+//
+//	store := redisstore.New("localhost:6379", "", 0, redisstore.LayoutHash)
+//	cfg, err := kvmapstruct.Load[Config](ctx, store, "app")
+package redisstore
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/spf13/cast"
+
+	"github.com/uthng/kvmapstruct/internal/kvpath"
+)
+
+// scanCount is the number of keys requested per SCAN call.
+const scanCount = 100
+
+// Layout is the way KV paths are mapped to Redis keys.
+type Layout int
+
+const (
+	// LayoutKeys stores one string key per KV path.
+	LayoutKeys Layout = iota
+	// LayoutHash stores one hash per parent path whose fields
+	// are the last segments of the KV paths.
+	LayoutHash
+)
+
+// Store contains Redis informations.
+type Store struct {
+	// Client is redis client
+	Client redis.UniversalClient
+	// Layout is the way KV paths are mapped to Redis keys
+	Layout Layout
+}
+
+// New creates a new *Store connected to the Redis server at addr.
+// Addr format is ip:port.
+func New(addr, password string, db int, layout Layout) *Store {
+	client := redis.NewClient(&redis.Options{
+		Addr:     addr,
+		Password: password,
+		DB:       db,
+	})
+
+	return NewFromClient(client, layout)
+}
+
+// NewFromClient creates a new *Store with an existing redis client.
+func NewFromClient(client redis.UniversalClient, layout Layout) *Store {
+	return &Store{
+		Client: client,
+		Layout: layout,
+	}
+}
+
+// Close closes the redis client.
+func (s *Store) Close() error {
+	return s.Client.Close()
+}
+
+// List implements kvmapstruct.Store.
+func (s *Store) List(ctx context.Context, prefix string) (map[string]interface{}, error) {
+	prefix = strings.Trim(prefix, "/")
+
+	if s.Layout == LayoutHash {
+		return s.listHashes(ctx, prefix)
+	}
+
+	return s.listKeys(ctx, prefix)
+}
+
+// Put implements kvmapstruct.Store. All kv pairs are written in
+// a single MULTI/EXEC transaction.
+func (s *Store) Put(ctx context.Context, kvmap map[string]interface{}) error {
+	hashes := make(map[string]map[string]interface{})
+
+	// Check keys before writing anything
+	for k, v := range kvmap {
+		key := strings.Trim(k, "/")
+		if key == "" {
+			return fmt.Errorf("invalid key %q", k)
+		}
+
+		if s.Layout != LayoutHash {
+			continue
+		}
+
+		i := strings.LastIndex(key, "/")
+		if i < 0 {
+			return fmt.Errorf("key %s has no parent path for a hash", key)
+		}
+
+		if hashes[key[:i]] == nil {
+			hashes[key[:i]] = make(map[string]interface{})
+		}
+
+		hashes[key[:i]][key[i+1:]] = cast.ToString(v)
+	}
+
+	_, err := s.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		if s.Layout == LayoutHash {
+			for h, fields := range hashes {
+				pipe.HSet(ctx, h, fields)
+			}
+
+			return nil
+		}
+
+		for k, v := range kvmap {
+			pipe.Set(ctx, strings.Trim(k, "/"), cast.ToString(v), 0)
+		}
+
+		return nil
+	})
+
+	return err
+}
+
+// listKeys lists the string keys under prefix.
+func (s *Store) listKeys(ctx context.Context, prefix string) (map[string]interface{}, error) {
+	m := make(map[string]interface{})
+
+	keys, err := s.scan(ctx, prefix, "string")
+	if err != nil {
+		return nil, err
+	}
+
+	if len(keys) == 0 {
+		return m, nil
+	}
+
+	values, err := s.Client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	for i, v := range values {
+		// Keys deleted since the scan are nil
+		if v != nil {
+			m[keys[i]] = cast.ToString(v)
+		}
+	}
+
+	return m, nil
+}
+
+// listHashes lists the fields of the hashes under prefix. The
+// hash of the parent path of prefix is read too, as prefix can
+// be one of its fields.
+func (s *Store) listHashes(ctx context.Context, prefix string) (map[string]interface{}, error) {
+	m := make(map[string]interface{})
+
+	hashes, err := s.scan(ctx, prefix, "hash")
+	if err != nil {
+		return nil, err
+	}
+
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		hashes = append(hashes, prefix[:i])
+	}
+
+	for _, h := range hashes {
+		fields, err := s.Client.HGetAll(ctx, h).Result()
+		if err != nil {
+			return nil, err
+		}
+
+		for f, v := range fields {
+			k := h + "/" + f
+			if kvpath.InPath(k, prefix) {
+				m[k] = v
+			}
+		}
+	}
+
+	return m, nil
+}
+
+// scan returns the keys of type keyType that are prefix itself
+// or are under prefix.
+func (s *Store) scan(ctx context.Context, prefix, keyType string) ([]string, error) {
+	var keys []string
+
+	match := "*"
+	if prefix != "" {
+		match = escapePattern(prefix) + "*"
+	}
+
+	iter := s.Client.ScanType(ctx, 0, match, scanCount, keyType).Iterator()
+	for iter.Next(ctx) {
+		// The SCAN pattern also matches siblings, app2/Env for app
+		if kvpath.InPath(iter.Val(), prefix) {
+			keys = append(keys, iter.Val())
+		}
+	}
+
+	return keys, iter.Err()
+}
+
+// escapePattern escapes the special characters of Redis glob patterns.
+func escapePattern(s string) string {
+	var b strings.Builder
+
+	for _, r := range s {
+		switch r {
+		case '*', '?', '[', ']', '\\', '^', '-':
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,89 @@
+package redisstore
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"github.com/uthng/kvmapstruct/internal/storetest"
+)
+
+func TestStore(t *testing.T) {
+	testCases := []struct {
+		name   string
+		layout Layout
+		check  func(t *testing.T, mr *miniredis.Miniredis)
+	}{
+		{
+			"KeyPerLeaf",
+			LayoutKeys,
+			func(t *testing.T, mr *miniredis.Miniredis) {
+				mr.CheckGet(t, "app/DB/Host", "db.prod")
+				mr.CheckGet(t, "app/Hosts/1", "host2")
+			},
+		},
+		{
+			"HashPerParent",
+			LayoutHash,
+			func(t *testing.T, mr *miniredis.Miniredis) {
+				if v := mr.HGet("app/DB", "Host"); v != "db.prod" {
+					t.Errorf("wrong field Host of app/DB: %s", v)
+				}
+				if v := mr.HGet("app", "Env"); v != "prod" {
+					t.Errorf("wrong field Env of app: %s", v)
+				}
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mr := miniredis.RunT(t)
+			store := New(mr.Addr(), "", 0, tc.layout)
+			defer store.Close()
+
+			storetest.Run(t, store, "app")
+
+			tc.check(t, mr)
+		})
+	}
+
+}
+
+func TestStoreAtomicPut(t *testing.T) {
+	mr := miniredis.RunT(t)
+	store := New(mr.Addr(), "", 0, LayoutHash)
+	defer store.Close()
+
+	// A key without parent path makes the whole save fail
+	err := store.Put(context.Background(), map[string]interface{}{
+		"app/Env": "prod",
+		"Workers": "4",
+	})
+	if err == nil {
+		t.Fatalf("key without parent path written")
+	}
+
+	if mr.Exists("app") {
+		t.Errorf("partial write")
+	}
+
+}
+
+func TestEscapePattern(t *testing.T) {
+	testCases := []struct {
+		input  string
+		output string
+	}{
+		{"app/prod", "app/prod"},
+		{"app*/[x]?", `app\*/\[x\]\?`},
+	}
+
+	for _, tc := range testCases {
+		if o := escapePattern(tc.input); o != tc.output {
+			t.Errorf("\nwant:\n%v\nhave:\n%v", tc.output, o)
+		}
+	}
+
+}
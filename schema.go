@@ -0,0 +1,257 @@
+package kvmapstruct
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/spf13/cast"
+)
+
+// jsonSchemaVersion is the JSON Schema draft of generated schemas.
+const jsonSchemaVersion = "http://json-schema.org/draft-07/schema#"
+
+// KeySpec describes a Consul key expected by a Go struct.
+// Elements of a slice are stored under Key/0, Key/1 etc.
+// and entries of a map under Key/<name>.
+type KeySpec struct {
+	Key         string `json:"key"`
+	Field       string `json:"field"`
+	Type        string `json:"type"`
+	Default     string `json:"default,omitempty"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+	Sensitive   bool   `json:"sensitive,omitempty"`
+}
+
+// KeySpecs lists the Consul keys under prefix that KVMapToStruct reads
+// to decode the Go struct st, in field order. Defaults and descriptions
+// come from the default and description tags and a key is required
+// if its field has the nonempty validation rule.
+// st argument can be a Go struct or a pointer to a Go struct,
+// initialized or not.
+func KeySpecs(st interface{}, prefix string) []KeySpec {
+	var specs []KeySpec
+
+	for _, f := range structFields(reflect.TypeOf(st), prefix) {
+		specs = append(specs, KeySpec{
+			Key:         f.Key,
+			Field:       f.Path,
+			Type:        f.Field.Type.String(),
+			Default:     f.Field.Tag.Get(defaultTagName),
+			Description: f.Field.Tag.Get(descriptionTagName),
+			Required:    hasRule(f.Field, "nonempty"),
+			Sensitive:   f.Options.Has("sensitive") || f.Options.Has("secret"),
+		})
+	}
+
+	return specs
+}
+
+// JSONSchema generates the JSON Schema of the nested map the Go struct
+// st is stored as, KVMapToMap's layout. Defaults, descriptions and
+// validation rules of the fields are part of the schema.
+// st argument can be a Go struct or a pointer to a Go struct,
+// initialized or not.
+func JSONSchema(st interface{}) ([]byte, error) {
+	t := reflect.TypeOf(st)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("Error: input is not a Go struct")
+	}
+
+	schema := structSchema(t)
+	schema["$schema"] = jsonSchemaVersion
+	schema["title"] = t.Name()
+
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+// structSchema returns the JSON Schema of a Go struct type.
+func structSchema(t reflect.Type) map[string]interface{} {
+	var required []string
+
+	props := make(map[string]interface{})
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		// Skip unexported fields
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+
+		ft := field.Type
+		if ft.Kind() == reflect.Ptr && ft.Elem().Kind() == reflect.Struct {
+			ft = ft.Elem()
+		}
+
+		if ft.Kind() == reflect.Struct {
+			props[field.Name] = structSchema(ft)
+		} else {
+			props[field.Name] = fieldSchema(field)
+		}
+
+		if hasRule(field, "nonempty") {
+			required = append(required, field.Name)
+		}
+	}
+
+	schema := map[string]interface{}{
+		"type":                 "object",
+		"properties":           props,
+		"additionalProperties": false,
+	}
+
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+
+	return schema
+}
+
+// fieldSchema returns the JSON Schema of a leaf field.
+func fieldSchema(field reflect.StructField) map[string]interface{} {
+	t := field.Type
+	schema := map[string]interface{}{
+		"type": jsonType(t),
+	}
+
+	switch t.Kind() {
+	case reflect.Slice:
+		schema["items"] = map[string]interface{}{
+			"type": jsonType(t.Elem()),
+		}
+	case reflect.Map:
+		schema["additionalProperties"] = true
+	}
+
+	if d, ok := field.Tag.Lookup(defaultTagName); ok {
+		schema["default"] = defaultValue(t, d)
+	}
+
+	if d := field.Tag.Get(descriptionTagName); d != "" {
+		schema["description"] = d
+	}
+
+	// Schema keywords depend on the type for min and max
+	minKey, maxKey := "minimum", "maximum"
+	switch t.Kind() {
+	case reflect.String:
+		minKey, maxKey = "minLength", "maxLength"
+	case reflect.Slice:
+		minKey, maxKey = "minItems", "maxItems"
+	case reflect.Map:
+		minKey, maxKey = "minProperties", "maxProperties"
+	}
+
+	// Rules other than nonempty, min and max apply to slice elements
+	elem := schema
+	if t.Kind() == reflect.Slice {
+		elem = schema["items"].(map[string]interface{})
+	}
+
+	for _, rule := range parseRules(field.Tag.Get(validateTagName)) {
+		name := rule
+		arg := ""
+
+		if i := strings.Index(rule, "="); i >= 0 {
+			name = rule[:i]
+			arg = rule[i+1:]
+		}
+
+		switch name {
+		case "nonempty":
+			switch t.Kind() {
+			case reflect.String:
+				schema["minLength"] = 1
+			case reflect.Slice:
+				schema["minItems"] = 1
+			case reflect.Map:
+				schema["minProperties"] = 1
+			}
+		case "min":
+			schema[minKey] = cast.ToFloat64(arg)
+		case "max":
+			schema[maxKey] = cast.ToFloat64(arg)
+		case "oneof":
+			var enum []interface{}
+			for _, v := range strings.Fields(arg) {
+				enum = append(enum, defaultValue(t, v))
+			}
+			elem["enum"] = enum
+		case "port":
+			elem["minimum"] = 1
+			elem["maximum"] = 65535
+		case "url":
+			elem["format"] = "uri"
+		case "regexp":
+			elem["pattern"] = arg
+		}
+	}
+
+	return schema
+}
+
+// jsonType returns the JSON Schema type of a Go type.
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Map, reflect.Struct:
+		return "object"
+	}
+
+	return "string"
+}
+
+// defaultValue converts a default tag value to the type t.
+// If t is a slice, s is a comma separated list of elements.
+func defaultValue(t reflect.Type, s string) interface{} {
+	if t.Kind() == reflect.Slice {
+		var values []interface{}
+
+		if s == "" {
+			return []interface{}{}
+		}
+
+		for _, e := range strings.Split(s, ",") {
+			values = append(values, defaultValue(t.Elem(), e))
+		}
+
+		return values
+	}
+
+	switch jsonType(t) {
+	case "boolean":
+		return cast.ToBool(s)
+	case "integer":
+		return cast.ToInt64(s)
+	case "number":
+		return cast.ToFloat64(s)
+	}
+
+	return s
+}
+
+// hasRule checks if a field has the validation rule name.
+func hasRule(field reflect.StructField, name string) bool {
+	for _, rule := range parseRules(field.Tag.Get(validateTagName)) {
+		if rule == name || strings.HasPrefix(rule, name+"=") {
+			return true
+		}
+	}
+
+	return false
+}
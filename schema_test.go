@@ -0,0 +1,120 @@
+package kvmapstruct
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+type schemaDB struct {
+	Host     string `default:"localhost" description:"Database host" validate:"nonempty"`
+	Port     int    `default:"5432" validate:"port"`
+	Password string `kv:",secret"`
+}
+
+type schemaST struct {
+	Env     string   `default:"dev" validate:"oneof=dev prod"`
+	Workers int      `validate:"min=1,max=16"`
+	Tags    []string `default:"a,b"`
+	Debug   bool
+	Labels  map[string]interface{}
+	DB      *schemaDB
+}
+
+func TestKeySpecs(t *testing.T) {
+	testCases := []struct {
+		name   string
+		prefix string
+		input  interface{}
+		output []KeySpec
+	}{
+		{
+			"NilPointerToStruct",
+			"test",
+			(*schemaST)(nil),
+			[]KeySpec{
+				{Key: "test/Env", Field: "Env", Type: "string", Default: "dev"},
+				{Key: "test/Workers", Field: "Workers", Type: "int"},
+				{Key: "test/Tags", Field: "Tags", Type: "[]string", Default: "a,b"},
+				{Key: "test/Debug", Field: "Debug", Type: "bool"},
+				{Key: "test/Labels", Field: "Labels", Type: "map[string]interface {}"},
+				{Key: "test/DB/Host", Field: "DB.Host", Type: "string", Default: "localhost", Description: "Database host", Required: true},
+				{Key: "test/DB/Port", Field: "DB.Port", Type: "int", Default: "5432"},
+				{Key: "test/DB/Password", Field: "DB.Password", Type: "string", Sensitive: true},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			o := KeySpecs(tc.input, tc.prefix)
+
+			if !reflect.DeepEqual(o, tc.output) {
+				t.Errorf("\nwant:\n%v\nhave:\n%v", tc.output, o)
+			}
+		})
+	}
+
+}
+
+func TestJSONSchema(t *testing.T) {
+	testCases := []struct {
+		name   string
+		input  interface{}
+		output string
+	}{
+		{
+			"StructWithTags",
+			schemaST{},
+			`{
+				"$schema": "http://json-schema.org/draft-07/schema#",
+				"title": "schemaST",
+				"type": "object",
+				"additionalProperties": false,
+				"properties": {
+					"Env": {"type": "string", "default": "dev", "enum": ["dev", "prod"]},
+					"Workers": {"type": "integer", "minimum": 1, "maximum": 16},
+					"Tags": {"type": "array", "items": {"type": "string"}, "default": ["a", "b"]},
+					"Debug": {"type": "boolean"},
+					"Labels": {"type": "object", "additionalProperties": true},
+					"DB": {
+						"type": "object",
+						"additionalProperties": false,
+						"required": ["Host"],
+						"properties": {
+							"Host": {"type": "string", "default": "localhost", "description": "Database host", "minLength": 1},
+							"Port": {"type": "integer", "default": 5432, "minimum": 1, "maximum": 65535},
+							"Password": {"type": "string"}
+						}
+					}
+				}
+			}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var have, want interface{}
+
+			data, err := JSONSchema(tc.input)
+			if err != nil {
+				t.Fatalf("%s", err)
+			}
+
+			err = json.Unmarshal(data, &have)
+			if err != nil {
+				t.Fatalf("%s", err)
+			}
+
+			err = json.Unmarshal([]byte(tc.output), &want)
+			if err != nil {
+				t.Fatalf("%s", err)
+			}
+
+			if !reflect.DeepEqual(have, want) {
+				t.Errorf("\nwant:\n%s\nhave:\n%s", tc.output, data)
+			}
+		})
+	}
+
+}
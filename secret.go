@@ -0,0 +1,197 @@
+package kvmapstruct
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+
+	consul "github.com/hashicorp/consul/api"
+	"github.com/spf13/cast"
+)
+
+// secretPrefix marks the values encrypted by this package.
+const secretPrefix = "enc:v1:"
+
+// KeyProvider provides the key used to encrypt and decrypt
+// the values of fields tagged with `kv:",secret"`.
+type KeyProvider interface {
+	// Key returns an AES-128, AES-192 or AES-256 key.
+	Key() ([]byte, error)
+}
+
+// KeyFileProvider is a KeyProvider reading the key from a local file.
+// The file contains either the raw key or its hex encoding.
+// It is mainly intended for testing.
+type KeyFileProvider struct {
+	// Filename is the path of the key file
+	Filename string
+}
+
+// NewKeyFileProvider creates a new *KeyFileProvider.
+func NewKeyFileProvider(filename string) *KeyFileProvider {
+	return &KeyFileProvider{
+		Filename: filename,
+	}
+}
+
+// Key reads the key from the key file.
+func (p *KeyFileProvider) Key() ([]byte, error) {
+	data, err := ioutil.ReadFile(p.Filename)
+	if err != nil {
+		return nil, err
+	}
+
+	// Hex encoded keys are 32, 48 or 64 chars long
+	text := bytes.TrimSpace(data)
+	switch len(text) {
+	case 32, 48, 64:
+		if key, err := hex.DecodeString(string(text)); err == nil {
+			return key, nil
+		}
+	}
+
+	switch len(data) {
+	case 16, 24, 32:
+		return data, nil
+	}
+
+	return nil, fmt.Errorf("invalid key size in %s: key must be 16, 24 or 32 bytes", p.Filename)
+}
+
+// encryptValue encrypts value with AES-GCM and returns it encoded
+// as secretPrefix followed by base64 of nonce and ciphertext.
+func encryptValue(kp KeyProvider, value []byte) ([]byte, error) {
+	gcm, err := newGCM(kp)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed := gcm.Seal(nonce, nonce, value, nil)
+
+	return []byte(secretPrefix + base64.StdEncoding.EncodeToString(sealed)), nil
+}
+
+// decryptValue decrypts a value encrypted by encryptValue.
+func decryptValue(kp KeyProvider, value []byte) ([]byte, error) {
+	if !bytes.HasPrefix(value, []byte(secretPrefix)) {
+		return nil, fmt.Errorf("value is not encrypted")
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(string(value[len(secretPrefix):]))
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(kp)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < gcm.NonceSize() {
+		return nil, fmt.Errorf("encrypted value is too short")
+	}
+
+	nonce := sealed[:gcm.NonceSize()]
+
+	return gcm.Open(nil, nonce, sealed[gcm.NonceSize():], nil)
+}
+
+// newGCM creates an AES-GCM cipher with the key of the provider.
+func newGCM(kp KeyProvider) (cipher.AEAD, error) {
+	if kp == nil {
+		return nil, fmt.Errorf("no key provider to handle secret fields")
+	}
+
+	key, err := kp.Key()
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// secretFields returns the fields of struct type t tagged as secret.
+func secretFields(t reflect.Type, prefix string) []structField {
+	var secrets []structField
+
+	for _, f := range structFields(t, prefix) {
+		if f.Options.Has("secret") {
+			secrets = append(secrets, f)
+		}
+	}
+
+	return secrets
+}
+
+// encryptPairs encrypts in place the values of secret kv pairs.
+func (kms *KVMapStruct) encryptPairs(pairs consul.KVPairs, secrets []structField) error {
+	for _, kv := range pairs {
+		if !matchFields(secrets, kv.Key) {
+			continue
+		}
+
+		v, err := encryptValue(kms.KeyProvider, kv.Value)
+		if err != nil {
+			return fmt.Errorf("error encrypting key %s: %s", kv.Key, err)
+		}
+
+		kv.Value = v
+	}
+
+	return nil
+}
+
+// decryptPairs decrypts in place the values of secret kv pairs.
+func (kms *KVMapStruct) decryptPairs(pairs consul.KVPairs, secrets []structField) error {
+	for _, kv := range pairs {
+		if !matchFields(secrets, kv.Key) {
+			continue
+		}
+
+		v, err := decryptValue(kms.KeyProvider, kv.Value)
+		if err != nil {
+			return fmt.Errorf("error decrypting key %s: %s", kv.Key, err)
+		}
+
+		kv.Value = v
+	}
+
+	return nil
+}
+
+// decryptKVMap decrypts in place the values of secret keys of a KV map.
+func (kms *KVMapStruct) decryptKVMap(m map[string]interface{}, secrets []structField) error {
+	for k, val := range m {
+		if !matchFields(secrets, k) || strings.HasSuffix(k, "/") {
+			continue
+		}
+
+		v, err := decryptValue(kms.KeyProvider, []byte(cast.ToString(val)))
+		if err != nil {
+			return fmt.Errorf("error decrypting key %s: %s", k, err)
+		}
+
+		m[k] = string(v)
+	}
+
+	return nil
+}
@@ -0,0 +1,157 @@
+package kvmapstruct
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestKeyFileProvider(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kvmapstruct")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	testCases := []struct {
+		name    string
+		content string
+		output  []byte
+		err     bool
+	}{
+		{
+			"RawKey",
+			"0123456789abcdef",
+			[]byte("0123456789abcdef"),
+			false,
+		},
+		{
+			"HexKey",
+			"000102030405060708090a0b0c0d0e0f\n",
+			[]byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15},
+			false,
+		},
+		{
+			"InvalidKeySize",
+			"tooshort",
+			nil,
+			true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			filename := filepath.Join(dir, tc.name)
+
+			err := ioutil.WriteFile(filename, []byte(tc.content), 0600)
+			if err != nil {
+				t.Fatalf("%s", err)
+			}
+
+			key, err := NewKeyFileProvider(filename).Key()
+			if (err != nil) != tc.err {
+				t.Errorf("unexpected error: %v", err)
+			}
+
+			if !bytes.Equal(key, tc.output) {
+				t.Errorf("\nwant:\n%v\nhave:\n%v", tc.output, key)
+			}
+		})
+	}
+
+}
+
+func TestSecretKVMap(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kvmapstruct")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "key")
+	err = ioutil.WriteFile(filename, []byte("0123456789abcdef0123456789abcdef"), 0600)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	type STChild struct {
+		Password string   `kv:",secret"`
+		Tokens   []string `kv:",secret"`
+	}
+
+	type ST struct {
+		User  string
+		Token string `kv:",secret"`
+		DB    *STChild
+	}
+
+	testCases := []struct {
+		name   string
+		prefix string
+		input  ST
+	}{
+		{
+			"StructWithSecrets",
+			"test",
+			ST{
+				User:  "user",
+				Token: "token",
+				DB: &STChild{
+					Password: "pass",
+					Tokens:   []string{"token1", "token2"},
+				},
+			},
+		},
+	}
+
+	kms := &KVMapStruct{
+		KeyProvider: NewKeyFileProvider(filename),
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			kms.Path = tc.prefix
+
+			pairs, secrets, err := kms.inputToKVPairs(tc.input)
+			if err != nil {
+				t.Fatalf("%s", err)
+			}
+
+			err = kms.encryptPairs(pairs, secrets)
+			if err != nil {
+				t.Fatalf("%s", err)
+			}
+
+			m := make(map[string]interface{})
+			for _, kv := range pairs {
+				encrypted := strings.HasPrefix(string(kv.Value), secretPrefix)
+				if encrypted != matchFields(secrets, kv.Key) {
+					t.Errorf("key %s: encrypted %v", kv.Key, encrypted)
+				}
+
+				m[kv.Key] = string(kv.Value)
+			}
+
+			st := &ST{DB: &STChild{}}
+
+			err = kms.decryptKVMap(m, secretFields(reflect.TypeOf(st), kms.Path))
+			if err != nil {
+				t.Fatalf("%s", err)
+			}
+
+			err = KVMapToStruct(m, kms.Path, st)
+			if err != nil {
+				t.Fatalf("%s", err)
+			}
+
+			if !reflect.DeepEqual(st, &tc.input) {
+				t.Errorf("\nwant:\n%v\nhave:\n%v", tc.input.DB, st.DB)
+			}
+		})
+	}
+
+}
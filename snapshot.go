@@ -0,0 +1,239 @@
+package kvmapstruct
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	consul "github.com/hashicorp/consul/api"
+
+	"github.com/uthng/kvmapstruct/internal/kvpath"
+)
+
+// SnapshotVersion is the format version of snapshots created by this package.
+const SnapshotVersion = 1
+
+// maxTxnOps is the maximum number of operations of a Consul transaction.
+const maxTxnOps = 128
+
+// SnapshotPair is a Consul kv pair captured in a snapshot.
+// Indexes are informative only: Consul assigns new ones on restore.
+type SnapshotPair struct {
+	Key         string `json:"key"`
+	Value       []byte `json:"value"`
+	Flags       uint64 `json:"flags"`
+	CreateIndex uint64 `json:"create_index"`
+	ModifyIndex uint64 `json:"modify_index"`
+}
+
+// Snapshot contains all kv pairs under a Consul path at a given index.
+type Snapshot struct {
+	Version   int            `json:"version"`
+	Path      string         `json:"path"`
+	Index     uint64         `json:"index"`
+	CreatedAt time.Time      `json:"created_at"`
+	Pairs     []SnapshotPair `json:"pairs"`
+}
+
+// Snapshot captures all kv pairs under kvmapstruct path
+// with their values, flags and indexes.
+func (kms *KVMapStruct) Snapshot() (*Snapshot, error) {
+	pairs, meta, err := kms.Client.KV().List(kms.Path, kms.queryOptions(nil))
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Snapshot{
+		Version:   SnapshotVersion,
+		Path:      kms.Path,
+		Index:     meta.LastIndex,
+		CreatedAt: time.Now().UTC(),
+		Pairs:     []SnapshotPair{},
+	}
+
+	for _, kv := range pairs {
+		if !kvpath.InPath(kv.Key, kms.Path) {
+			continue
+		}
+
+		s.Pairs = append(s.Pairs, SnapshotPair{
+			Key:         kv.Key,
+			Value:       kv.Value,
+			Flags:       kv.Flags,
+			CreateIndex: kv.CreateIndex,
+			ModifyIndex: kv.ModifyIndex,
+		})
+	}
+
+	return s, nil
+}
+
+// ErrRestoreConflict is returned by Restore when keys under the
+// snapshot path are written while restoring. Restore can be retried.
+var ErrRestoreConflict = errors.New("keys changed while restoring")
+
+// Restore replaces all kv pairs under the snapshot path by the
+// snapshot ones in a single Consul transaction: keys created after
+// the snapshot are deleted and the others are set to their saved
+// values and flags. Keys with the saved value and flags are left
+// untouched. Either all changes are applied or none. Consul limits
+// a transaction to 128 operations: restores changing more keys are
+// rejected without changing anything. Restores are not replicated:
+// they are rejected if Datacenters is set.
+//
+// Operations are pinned to the ModifyIndex of the keys listed before
+// the transaction. If keys are written concurrently, the transaction
+// is rolled back or, for keys it does not touch, the path still
+// differs from the snapshot afterwards: ErrRestoreConflict is returned
+// in both cases.
+func (kms *KVMapStruct) Restore(s *Snapshot) error {
+	if len(kms.Datacenters) > 0 {
+		return errNotReplicated("restore")
+	}
+
+	if s.Version != SnapshotVersion {
+		return fmt.Errorf("snapshot version %d not supported", s.Version)
+	}
+
+	ops, err := kms.restoreOps(s)
+	if err != nil {
+		return err
+	}
+
+	return kms.commitRestore(s, ops)
+}
+
+// restoreOps returns the cas operations needed to go from the current
+// kv pairs under the snapshot path to the snapshot ones.
+func (kms *KVMapStruct) restoreOps(s *Snapshot) (consul.KVTxnOps, error) {
+	var ops consul.KVTxnOps
+
+	pairs, _, err := kms.Client.KV().List(s.Path, kms.queryOptions(nil))
+	if err != nil {
+		return nil, err
+	}
+
+	current := make(map[string]*consul.KVPair)
+	for _, kv := range pairs {
+		if kvpath.InPath(kv.Key, s.Path) {
+			current[kv.Key] = kv
+		}
+	}
+
+	saved := make(map[string]bool)
+	for _, p := range s.Pairs {
+		saved[p.Key] = true
+	}
+
+	for _, kv := range pairs {
+		if current[kv.Key] == nil || saved[kv.Key] {
+			continue
+		}
+
+		ops = append(ops, &consul.KVTxnOp{
+			Verb:  consul.KVDeleteCAS,
+			Key:   kv.Key,
+			Index: kv.ModifyIndex,
+		})
+	}
+
+	for _, p := range s.Pairs {
+		var index uint64
+
+		kv := current[p.Key]
+		if kv != nil {
+			if bytes.Equal(kv.Value, p.Value) && kv.Flags == p.Flags {
+				continue
+			}
+
+			index = kv.ModifyIndex
+		}
+
+		ops = append(ops, &consul.KVTxnOp{
+			Verb:  consul.KVCAS,
+			Key:   p.Key,
+			Value: p.Value,
+			Flags: p.Flags,
+			Index: index,
+		})
+	}
+
+	return ops, nil
+}
+
+// commitRestore executes the restore operations ops in a transaction
+// and checks that nothing is left to restore afterwards.
+func (kms *KVMapStruct) commitRestore(s *Snapshot, ops consul.KVTxnOps) error {
+	if len(ops) > maxTxnOps {
+		return fmt.Errorf("restore of %s changes %d keys, more than the %d operations of a Consul transaction", s.Path, len(ops), maxTxnOps)
+	}
+
+	if len(ops) == 0 {
+		return nil
+	}
+
+	ok, resp, _, err := kms.Client.KV().Txn(ops, kms.queryOptions(nil))
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		if len(resp.Errors) > 0 {
+			e := resp.Errors[0]
+			if strings.Contains(e.What, "index is stale") {
+				return fmt.Errorf("%w: key %s", ErrRestoreConflict, ops[e.OpIndex].Key)
+			}
+
+			return fmt.Errorf("restore rolled back at key %s: %s", ops[e.OpIndex].Key, e.What)
+		}
+
+		return fmt.Errorf("restore rolled back")
+	}
+
+	// Keys created or written outside the operations
+	left, err := kms.restoreOps(s)
+	if err != nil {
+		return err
+	}
+
+	if len(left) > 0 {
+		return fmt.Errorf("%w: key %s", ErrRestoreConflict, left[0].Key)
+	}
+
+	return nil
+}
+
+// WriteFile saves the snapshot as a JSON document to filename.
+func (s *Snapshot) WriteFile(filename string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filename, data, 0600)
+}
+
+// ReadSnapshotFile loads a snapshot previously saved with WriteFile.
+func ReadSnapshotFile(filename string) (*Snapshot, error) {
+	s := &Snapshot{}
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, s)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.Version != SnapshotVersion {
+		return nil, fmt.Errorf("snapshot version %d not supported", s.Version)
+	}
+
+	return s, nil
+}
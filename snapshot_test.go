@@ -0,0 +1,288 @@
+package kvmapstruct
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	consul "github.com/hashicorp/consul/api"
+)
+
+func TestSnapshotFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kvmapstruct")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	testCases := []struct {
+		name     string
+		snapshot *Snapshot
+	}{
+		{
+			"SnapshotWithPairs",
+			&Snapshot{
+				Version: SnapshotVersion,
+				Path:    "test",
+				Index:   42,
+				Pairs: []SnapshotPair{
+					{Key: "test/key1", Value: []byte("val1"), Flags: 3, CreateIndex: 10, ModifyIndex: 12},
+					{Key: "test/key2", Value: []byte("2"), CreateIndex: 11, ModifyIndex: 11},
+				},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			filename := filepath.Join(dir, tc.name+".json")
+
+			err := tc.snapshot.WriteFile(filename)
+			if err != nil {
+				t.Fatalf("%s", err)
+			}
+
+			s, err := ReadSnapshotFile(filename)
+			if err != nil {
+				t.Fatalf("%s", err)
+			}
+
+			if !reflect.DeepEqual(s, tc.snapshot) {
+				t.Errorf("\nwant:\n%v\nhave:\n%v", tc.snapshot, s)
+			}
+		})
+	}
+
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	testCases := []struct {
+		name   string
+		prefix string
+		stored map[string]interface{}
+		update map[string]interface{}
+	}{
+		{
+			"RollbackConfigPush",
+			"test",
+			map[string]interface{}{
+				"test/key1":   "val1",
+				"test/key2":   "2",
+				"test/key3/0": "one",
+			},
+			map[string]interface{}{
+				"key1": "newval1",
+				"key3": []string{"one", "two"},
+				"key4": "val4",
+			},
+		},
+	}
+
+	kms, err := NewKVMapStruct("localhost:8500", "adf4238a-882b-9ddc-4a9d-5b6758e4159e", "test")
+	if err != nil {
+		t.Errorf("%s", err.Error())
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			out := make(map[string]interface{})
+
+			kms.Path = tc.prefix
+
+			// Insert data in to consul
+			for k, v := range tc.stored {
+				kv := &consul.KVPair{
+					Key:   k,
+					Value: []byte(v.(string)),
+				}
+
+				_, err := kms.Client.KV().Put(kv, nil)
+				if err != nil {
+					t.Errorf("%s", err)
+				}
+			}
+
+			s, err := kms.Snapshot()
+			if err != nil {
+				t.Fatalf("%s", err)
+			}
+
+			if len(s.Pairs) != len(tc.stored) {
+				t.Errorf("snapshot has %d pairs instead of %d", len(s.Pairs), len(tc.stored))
+			}
+
+			err = kms.MapToConsulKV(tc.update)
+			if err != nil {
+				t.Errorf("%s", err)
+			}
+
+			err = kms.Restore(s)
+			if err != nil {
+				t.Errorf("%s", err)
+			}
+
+			pairs, _, err := kms.Client.KV().List(tc.prefix, nil)
+			if err != nil {
+				t.Errorf("%s", err)
+			}
+
+			for _, kv := range pairs {
+				out[kv.Key] = string(kv.Value)
+			}
+
+			if !reflect.DeepEqual(out, tc.stored) {
+				t.Errorf("\nwant:\n%s\nhave:\n%s", tc.stored, out)
+			}
+
+			kms.Client.KV().DeleteTree(tc.prefix, nil)
+		})
+	}
+
+}
+
+func TestSnapshotRestoreTxnLimit(t *testing.T) {
+	kms, err := NewKVMapStruct("localhost:8500", "adf4238a-882b-9ddc-4a9d-5b6758e4159e", "test")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer kms.Client.KV().DeleteTree("test", nil)
+
+	stored := make(map[string]interface{})
+	for i := 0; i < 200; i++ {
+		stored[fmt.Sprintf("key%d", i)] = "val"
+	}
+
+	err = kms.MapToConsulKV(stored)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	s, err := kms.Snapshot()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	testCases := []struct {
+		name    string
+		changed int
+		err     bool
+	}{
+		{"Unchanged", 0, false},
+		{"FewChanges", 10, false},
+		{"TooManyChanges", maxTxnOps + 1, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			update := make(map[string]interface{})
+			for i := 0; i < tc.changed; i++ {
+				update[fmt.Sprintf("key%d", i)] = "newval"
+			}
+
+			err := kms.MapToConsulKV(update)
+			if err != nil {
+				t.Fatalf("%s", err)
+			}
+
+			err = kms.Restore(s)
+			if tc.err != (err != nil) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			pairs, _, err := kms.Client.KV().List("test", nil)
+			if err != nil {
+				t.Fatalf("%s", err)
+			}
+
+			changed := 0
+			for _, kv := range pairs {
+				if string(kv.Value) != "val" {
+					changed++
+				}
+			}
+
+			// Rejected restores change nothing
+			want := 0
+			if tc.err {
+				want = tc.changed
+			}
+
+			if changed != want {
+				t.Errorf("%d keys changed instead of %d", changed, want)
+			}
+		})
+	}
+
+}
+
+func TestSnapshotRestoreConflict(t *testing.T) {
+	kms, err := NewKVMapStruct("localhost:8500", "adf4238a-882b-9ddc-4a9d-5b6758e4159e", "test")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer kms.Client.KV().DeleteTree("test", nil)
+
+	testCases := []struct {
+		name  string
+		write map[string]interface{}
+	}{
+		{"ModifiedKey", map[string]interface{}{"key1": "other"}},
+		{"CreatedKey", map[string]interface{}{"key3": "val3"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := kms.MapToConsulKV(map[string]interface{}{"key1": "val1", "key2": "val2"})
+			if err != nil {
+				t.Fatalf("%s", err)
+			}
+
+			s, err := kms.Snapshot()
+			if err != nil {
+				t.Fatalf("%s", err)
+			}
+
+			err = kms.MapToConsulKV(map[string]interface{}{"key1": "newval1"})
+			if err != nil {
+				t.Fatalf("%s", err)
+			}
+
+			ops, err := kms.restoreOps(s)
+			if err != nil {
+				t.Fatalf("%s", err)
+			}
+
+			// Concurrent write between the listing and the transaction
+			err = kms.MapToConsulKV(tc.write)
+			if err != nil {
+				t.Fatalf("%s", err)
+			}
+
+			err = kms.commitRestore(s, ops)
+			if !errors.Is(err, ErrRestoreConflict) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			// Restores can be retried
+			err = kms.Restore(s)
+			if err != nil {
+				t.Fatalf("%s", err)
+			}
+
+			m, err := kms.ConsulKVToMap()
+			if err != nil {
+				t.Fatalf("%s", err)
+			}
+
+			want := map[string]interface{}{"key1": "val1", "key2": "val2"}
+			if !reflect.DeepEqual(m, want) {
+				t.Errorf("\nwant:\n%v\nhave:\n%v", want, m)
+			}
+		})
+	}
+
+}
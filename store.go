@@ -0,0 +1,107 @@
+package kvmapstruct
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	consul "github.com/hashicorp/consul/api"
+	"github.com/spf13/cast"
+)
+
+// Store is a key/value backend holding KV maps. Keys are
+// "/" separated paths, as in Consul.
+type Store interface {
+	// List returns the KV map of all keys under prefix.
+	// Folder keys are skipped.
+	List(ctx context.Context, prefix string) (map[string]interface{}, error)
+	// Put writes all kv pairs of the KV map. Values are
+	// converted to strings. Implementations document whether
+	// the write is atomic and the size limits they enforce.
+	Put(ctx context.Context, kvmap map[string]interface{}) error
+}
+
+// Watcher is a Store able to wait for changes of the keys under a prefix.
+type Watcher interface {
+	Store
+	// Watch blocks until the keys under prefix change after index,
+	// the backend wait time expires or ctx is done. It returns the KV
+	// map of all keys under prefix and the new index. Index 0 returns
+	// immediately.
+	Watch(ctx context.Context, prefix string, index uint64) (map[string]interface{}, uint64, error)
+}
+
+// List implements Store.
+func (kms *KVMapStruct) List(ctx context.Context, prefix string) (map[string]interface{}, error) {
+	pairs, _, err := kms.listPrefix(prefix, (&consul.QueryOptions{}).WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	return pairsToKVMap(pairs), nil
+}
+
+// Put implements Store. Kv pairs are written one by one: a failed
+// write leaves the kv pairs written before it in place.
+func (kms *KVMapStruct) Put(ctx context.Context, kvmap map[string]interface{}) error {
+	var pairs consul.KVPairs
+
+	for _, k := range sortedKeys(kvmap, kms.NaturalSort) {
+		pairs = append(pairs, &consul.KVPair{
+			Key:   k,
+			Value: []byte(cast.ToString(kvmap[k])),
+		})
+	}
+
+	return kms.putPairs(pairs, (&consul.WriteOptions{}).WithContext(ctx))
+}
+
+// Watch implements Watcher with Consul blocking queries on the keys
+// under prefix/, so that sibling keys sharing prefix as string prefix,
+// app2/Env for app, do not wake it up. The key prefix itself is not
+// watched.
+func (kms *KVMapStruct) Watch(ctx context.Context, prefix string, index uint64) (map[string]interface{}, uint64, error) {
+	q := &consul.QueryOptions{
+		WaitIndex: index,
+	}
+
+	if prefix != "" {
+		prefix = strings.TrimSuffix(prefix, "/") + "/"
+	}
+
+	pairs, meta, err := kms.listPrefix(prefix, q.WithContext(ctx))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return pairsToKVMap(pairs), meta.LastIndex, nil
+}
+
+// encryptKVMap encrypts in place the values of secret keys of a KV map.
+func (kms *KVMapStruct) encryptKVMap(m map[string]interface{}, secrets []structField) error {
+	for k, val := range m {
+		if !matchFields(secrets, k) || strings.HasSuffix(k, "/") {
+			continue
+		}
+
+		v, err := encryptValue(kms.KeyProvider, []byte(cast.ToString(val)))
+		if err != nil {
+			return fmt.Errorf("error encrypting key %s: %s", k, err)
+		}
+
+		m[k] = string(v)
+	}
+
+	return nil
+}
+
+// pairsToKVMap converts consul kv pairs to a KV map.
+func pairsToKVMap(pairs consul.KVPairs) map[string]interface{} {
+	m := make(map[string]interface{})
+
+	for _, kv := range pairs {
+		m[kv.Key] = string(kv.Value)
+	}
+
+	return m
+}
@@ -0,0 +1,23 @@
+package kvmapstruct_test
+
+import (
+	"testing"
+
+	"github.com/uthng/kvmapstruct"
+	"github.com/uthng/kvmapstruct/internal/storetest"
+)
+
+func TestStoreConsul(t *testing.T) {
+	kms, err := kvmapstruct.NewKVMapStruct("localhost:8500", "adf4238a-882b-9ddc-4a9d-5b6758e4159e", "storetest")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer kms.Client.KV().DeleteTree("storetest", nil)
+
+	storetest.Run(t, kms, "storetest/app")
+
+	t.Run("Watch", func(t *testing.T) {
+		storetest.RunWatch(t, kms, "storetest/watch")
+	})
+
+}
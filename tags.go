@@ -0,0 +1,149 @@
+package kvmapstruct
+
+import (
+	"reflect"
+	"strings"
+)
+
+// tagName is the struct tag holding kvmapstruct field options.
+// Its format is `kv:",opt1,opt2"`. Keys are always built from
+// field names, so the name part before the first comma is ignored.
+const tagName = "kv"
+
+// defaultTagName is the struct tag holding the default value of a field.
+// Slice values are comma separated.
+const defaultTagName = "default"
+
+// descriptionTagName is the struct tag holding the description of a field.
+const descriptionTagName = "description"
+
+// tagOptions is the comma separated list of options of a kv tag.
+type tagOptions []string
+
+// parseTag splits a kv tag into its name and options.
+func parseTag(tag string) (string, tagOptions) {
+	parts := strings.Split(tag, ",")
+	return parts[0], tagOptions(parts[1:])
+}
+
+// Has checks if option name is set.
+func (o tagOptions) Has(name string) bool {
+	for _, opt := range o {
+		if opt == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// structField is a leaf field of a Go struct type with its KV key.
+type structField struct {
+	// Key is the kv key of the field: parent fields' names joined by /
+	Key string
+	// Path is the Go path of the field: parent fields' names joined by .
+	Path string
+	// Index is the index sequence of the field from the root struct
+	Index []int
+	// Field is the reflected field
+	Field reflect.StructField
+	// Options are the kv tag options
+	Options tagOptions
+}
+
+// structFields walks a Go struct type and returns all its leaf fields.
+// Substructs, pointers to struct and embedded structs are walked
+// recursively, exactly as KVMapToStruct and FlattenMapToStruct do.
+func structFields(t reflect.Type, prefix string) []structField {
+	var fields []structField
+
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	walkStructFields(t, prefix, "", nil, &fields)
+
+	return fields
+}
+
+// walkStructFields appends leaf fields of t to fields.
+func walkStructFields(t reflect.Type, key, path string, index []int, fields *[]structField) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		idx := append(append([]int{}, index...), i)
+
+		// Skip unexported fields
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+
+		k := field.Name
+		if key != "" {
+			k = key + "/" + field.Name
+		}
+
+		p := field.Name
+		if path != "" {
+			p = path + "." + field.Name
+		}
+
+		ft := field.Type
+		if ft.Kind() == reflect.Ptr && ft.Elem().Kind() == reflect.Struct {
+			ft = ft.Elem()
+		}
+
+		if ft.Kind() == reflect.Struct {
+			walkStructFields(ft, k, p, idx, fields)
+			continue
+		}
+
+		_, opts := parseTag(field.Tag.Get(tagName))
+
+		*fields = append(*fields, structField{
+			Key:     k,
+			Path:    p,
+			Index:   idx,
+			Field:   field,
+			Options: opts,
+		})
+	}
+}
+
+// value returns the value of the field in v, a struct or a pointer
+// to a struct of the walked type. It returns false if one of the
+// parent fields is a nil pointer.
+func (f structField) value(v reflect.Value) (reflect.Value, bool) {
+	for _, i := range f.Index {
+		for v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+
+		v = v.Field(i)
+	}
+
+	return v, true
+}
+
+// matchKey checks if key is the kv key of the field or one of its
+// children (slice elements or nested map keys).
+func (f structField) matchKey(key string) bool {
+	return key == f.Key || strings.HasPrefix(key, f.Key+"/")
+}
+
+// matchFields checks if key belongs to one of the fields.
+func matchFields(fields []structField, key string) bool {
+	for _, f := range fields {
+		if f.matchKey(key) {
+			return true
+		}
+	}
+
+	return false
+}
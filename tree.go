@@ -0,0 +1,349 @@
+package kvmapstruct
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cast"
+
+	"github.com/uthng/kvmapstruct/internal/kvpath"
+)
+
+// Tree wraps a nested map, as returned by KVMapToMap and ConsulKVToMap,
+// to access its values by path without type assertions. Paths are
+// "/" separated keys as in Consul: DB/Host is the key Host of the
+// submap DB and Hosts/1 is the second element of the slice Hosts.
+// The empty path is the root of the tree.
+type Tree struct {
+	m map[string]interface{}
+}
+
+// NewTree wraps the nested map m. The tree shares m: changes made
+// through the tree are visible in m. If m is nil, the tree is empty.
+func NewTree(m map[string]interface{}) *Tree {
+	if m == nil {
+		m = make(map[string]interface{})
+	}
+
+	return &Tree{m: m}
+}
+
+// KVMapToTree converts a KV map to a tree. Keys are relative to prefix.
+func KVMapToTree(in map[string]interface{}, prefix string) (*Tree, error) {
+	m, err := KVMapToMap(in, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewTree(m), nil
+}
+
+// ConsulKVToTree gets list of all consul keys from kvmapstruct path
+// and match them to a tree.
+func (kms *KVMapStruct) ConsulKVToTree() (*Tree, error) {
+	m, err := kms.ConsulKVToMap()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewTree(m), nil
+}
+
+// Map returns the nested map of the tree.
+func (t *Tree) Map() map[string]interface{} {
+	return t.m
+}
+
+// KVMap converts the tree to a KV map whose keys are under prefix.
+func (t *Tree) KVMap(prefix string) map[string]interface{} {
+	return MapToKVMap(t.m, prefix)
+}
+
+// Get returns the value at path. It returns false if there is no value.
+func (t *Tree) Get(path string) (interface{}, bool) {
+	var v interface{} = t.m
+
+	for _, s := range kvpath.Split(path) {
+		var ok bool
+
+		v, ok = child(v, s)
+		if !ok {
+			return nil, false
+		}
+	}
+
+	return v, true
+}
+
+// GetString returns the value at path converted to a string.
+func (t *Tree) GetString(path string) (string, error) {
+	v, err := t.get(path)
+	if err != nil {
+		return "", err
+	}
+
+	s, err := cast.ToStringE(v)
+	if err != nil {
+		return "", fmt.Errorf("error converting %s: %s", path, err)
+	}
+
+	return s, nil
+}
+
+// GetInt returns the value at path converted to an int.
+func (t *Tree) GetInt(path string) (int, error) {
+	v, err := t.get(path)
+	if err != nil {
+		return 0, err
+	}
+
+	i, err := cast.ToIntE(v)
+	if err != nil {
+		return 0, fmt.Errorf("error converting %s: %s", path, err)
+	}
+
+	return i, nil
+}
+
+// GetBool returns the value at path converted to a bool.
+func (t *Tree) GetBool(path string) (bool, error) {
+	v, err := t.get(path)
+	if err != nil {
+		return false, err
+	}
+
+	b, err := cast.ToBoolE(v)
+	if err != nil {
+		return false, fmt.Errorf("error converting %s: %s", path, err)
+	}
+
+	return b, nil
+}
+
+// GetDuration returns the value at path converted to a time.Duration.
+// Strings are parsed with time.ParseDuration, numbers are nanoseconds.
+func (t *Tree) GetDuration(path string) (time.Duration, error) {
+	v, err := t.get(path)
+	if err != nil {
+		return 0, err
+	}
+
+	d, err := cast.ToDurationE(v)
+	if err != nil {
+		return 0, fmt.Errorf("error converting %s: %s", path, err)
+	}
+
+	return d, nil
+}
+
+// GetSlice returns the slice at path as a []interface{}.
+func (t *Tree) GetSlice(path string) ([]interface{}, error) {
+	v, err := t.get(path)
+	if err != nil {
+		return nil, err
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice {
+		return nil, fmt.Errorf("error converting %s: %T is not a slice", path, v)
+	}
+
+	out := make([]interface{}, rv.Len())
+	for i := range out {
+		out[i] = rv.Index(i).Interface()
+	}
+
+	return out, nil
+}
+
+// Sub returns the subtree at path. The subtree shares the
+// submap of the tree.
+func (t *Tree) Sub(path string) (*Tree, error) {
+	v, err := t.get(path)
+	if err != nil {
+		return nil, err
+	}
+
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s is not a map", path)
+	}
+
+	return NewTree(m), nil
+}
+
+// Set sets value at path. Missing submaps are created. An element of
+// a slice can be replaced, or appended at the index following the last
+// element, if value has the type of the slice elements.
+func (t *Tree) Set(path string, value interface{}) error {
+	segments := kvpath.Split(path)
+	if len(segments) == 0 {
+		return fmt.Errorf("cannot set the root of the tree")
+	}
+
+	parent, last := segments[:len(segments)-1], segments[len(segments)-1]
+
+	var v interface{} = t.m
+	for i, s := range parent {
+		c, ok := child(v, s)
+		if !ok {
+			m, isMap := v.(map[string]interface{})
+			if !isMap {
+				return fmt.Errorf("cannot set %s: %s is not a map", path, strings.Join(parent[:i], "/"))
+			}
+
+			c = make(map[string]interface{})
+			m[s] = c
+		}
+
+		v = c
+	}
+
+	switch p := v.(type) {
+	case map[string]interface{}:
+		p[last] = value
+		return nil
+	default:
+		return setElem(t, parent, last, value)
+	}
+}
+
+// Delete removes the value at path. Removing an element of a slice
+// shifts the following elements. It returns false if there is no value.
+func (t *Tree) Delete(path string) bool {
+	segments := kvpath.Split(path)
+	if len(segments) == 0 {
+		return false
+	}
+
+	parent, last := segments[:len(segments)-1], segments[len(segments)-1]
+
+	v, ok := t.Get(strings.Join(parent, "/"))
+	if !ok {
+		return false
+	}
+
+	if m, ok := v.(map[string]interface{}); ok {
+		if _, ok := m[last]; !ok {
+			return false
+		}
+
+		delete(m, last)
+		return true
+	}
+
+	rv := reflect.ValueOf(v)
+	i, err := strconv.Atoi(last)
+	if rv.Kind() != reflect.Slice || err != nil || i < 0 || i >= rv.Len() {
+		return false
+	}
+
+	s := reflect.AppendSlice(rv.Slice(0, i), rv.Slice(i+1, rv.Len()))
+
+	// The slice header is stored in the parent, update it
+	t.Set(strings.Join(parent, "/"), s.Interface())
+
+	return true
+}
+
+// Walk calls fn for each leaf value of the tree with its path, in path
+// order. Slices are leaf values. If fn returns an error, Walk stops and
+// returns it.
+func (t *Tree) Walk(fn func(path string, value interface{}) error) error {
+	return walkTree(t.m, "", fn)
+}
+
+// get returns the value at path or an error if there is no value.
+func (t *Tree) get(path string) (interface{}, error) {
+	v, ok := t.Get(path)
+	if !ok {
+		return nil, fmt.Errorf("no value at %s", path)
+	}
+
+	return v, nil
+}
+
+// setElem sets value at index s of the slice at parent.
+func setElem(t *Tree, parent []string, s string, value interface{}) error {
+	path := strings.Join(parent, "/")
+	v, _ := t.Get(path)
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice {
+		return fmt.Errorf("cannot set %s/%s: %s is neither a map nor a slice", path, s, path)
+	}
+
+	i, err := strconv.Atoi(s)
+	if err != nil || i < 0 || i > rv.Len() {
+		return fmt.Errorf("cannot set %s/%s: index out of range", path, s)
+	}
+
+	e := reflect.ValueOf(value)
+	if !e.IsValid() || !e.Type().AssignableTo(rv.Type().Elem()) {
+		return fmt.Errorf("cannot set %s/%s: %T is not %s", path, s, value, rv.Type().Elem())
+	}
+
+	// Copy the slice so that other holders of the slice are not changed
+	ns := reflect.MakeSlice(rv.Type(), rv.Len(), rv.Len())
+	reflect.Copy(ns, rv)
+
+	if i == rv.Len() {
+		ns = reflect.Append(ns, e)
+	} else {
+		ns.Index(i).Set(e)
+	}
+
+	return t.Set(path, ns.Interface())
+}
+
+// child returns the child s of the map or slice v.
+func child(v interface{}, s string) (interface{}, bool) {
+	if m, ok := v.(map[string]interface{}); ok {
+		c, ok := m[s]
+		return c, ok
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice {
+		return nil, false
+	}
+
+	i, err := strconv.Atoi(s)
+	if err != nil || i < 0 || i >= rv.Len() {
+		return nil, false
+	}
+
+	return rv.Index(i).Interface(), true
+}
+
+// walkTree calls fn for each leaf value of m in key order.
+func walkTree(m map[string]interface{}, prefix string, fn func(string, interface{}) error) error {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		path := joinKey(prefix, k)
+
+		if sub, ok := m[k].(map[string]interface{}); ok {
+			err := walkTree(sub, path, fn)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		err := fn(path, m[k])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
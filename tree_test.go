@@ -0,0 +1,200 @@
+package kvmapstruct
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func newTestTree(t *testing.T) *Tree {
+	tree, err := KVMapToTree(map[string]interface{}{
+		"test/Env":         "prod",
+		"test/Debug":       "true",
+		"test/DB/Host":     "db.prod",
+		"test/DB/Port":     "5432",
+		"test/DB/Timeout":  "5s",
+		"test/Hosts/0":     "host1",
+		"test/Hosts/1":     "host2",
+		"test/Labels/team": "core",
+	}, "test")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	return tree
+}
+
+func TestTreeGet(t *testing.T) {
+	tree := newTestTree(t)
+
+	testCases := []struct {
+		name   string
+		get    func() (interface{}, error)
+		output interface{}
+		err    bool
+	}{
+		{"String", func() (interface{}, error) { return tree.GetString("Env") }, "prod", false},
+		{"NestedString", func() (interface{}, error) { return tree.GetString("DB/Host") }, "db.prod", false},
+		{"Int", func() (interface{}, error) { return tree.GetInt("DB/Port") }, 5432, false},
+		{"Bool", func() (interface{}, error) { return tree.GetBool("Debug") }, true, false},
+		{"Duration", func() (interface{}, error) { return tree.GetDuration("DB/Timeout") }, 5 * time.Second, false},
+		{"Slice", func() (interface{}, error) { return tree.GetSlice("Hosts") }, []interface{}{"host1", "host2"}, false},
+		{"SliceElem", func() (interface{}, error) { return tree.GetString("Hosts/1") }, "host2", false},
+		{"Missing", func() (interface{}, error) { return tree.GetString("DB/User") }, "", true},
+		{"WrongType", func() (interface{}, error) { return tree.GetInt("Env") }, 0, true},
+		{"NotSlice", func() (interface{}, error) { return tree.GetSlice("Env") }, []interface{}(nil), true},
+		{"ElemOutOfRange", func() (interface{}, error) { return tree.GetString("Hosts/2") }, "", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			v, err := tc.get()
+			if (err != nil) != tc.err {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(v, tc.output) {
+				t.Errorf("\nwant:\n%v\nhave:\n%v", tc.output, v)
+			}
+		})
+	}
+
+}
+
+func TestTreeSetDelete(t *testing.T) {
+	testCases := []struct {
+		name   string
+		set    map[string]interface{}
+		delete []string
+		output map[string]interface{}
+		err    bool
+	}{
+		{
+			"SetNewSubmap",
+			map[string]interface{}{"Cache/TTL": "1m"},
+			nil,
+			map[string]interface{}{
+				"test/Cache/TTL": "1m",
+			},
+			false,
+		},
+		{
+			"ReplaceAndAppendElem",
+			map[string]interface{}{"Hosts/0": "host0", "Hosts/2": "host3"},
+			nil,
+			map[string]interface{}{
+				"test/Hosts/0": "host0",
+				"test/Hosts/2": "host3",
+			},
+			false,
+		},
+		{
+			"DeleteKeyAndElem",
+			nil,
+			[]string{"DB/Host", "Hosts/0"},
+			map[string]interface{}{
+				"test/Hosts/0": "host2",
+			},
+			false,
+		},
+		{
+			"SetUnderLeaf",
+			map[string]interface{}{"Env/Name": "prod"},
+			nil,
+			map[string]interface{}{},
+			true,
+		},
+		{
+			"SetWrongElemType",
+			map[string]interface{}{"Hosts/0": 1},
+			nil,
+			map[string]interface{}{},
+			true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tree := newTestTree(t)
+			before := tree.KVMap("test")
+
+			for k, v := range tc.set {
+				err := tree.Set(k, v)
+				if (err != nil) != tc.err {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+
+			for _, k := range tc.delete {
+				if !tree.Delete(k) {
+					t.Errorf("%s not deleted", k)
+				}
+			}
+
+			after := tree.KVMap("test")
+
+			// Compare changed keys only
+			changed := make(map[string]interface{})
+			for k, v := range after {
+				if before[k] != v {
+					changed[k] = v
+				}
+			}
+
+			if !reflect.DeepEqual(changed, tc.output) {
+				t.Errorf("\nwant:\n%v\nhave:\n%v", tc.output, changed)
+			}
+		})
+	}
+
+}
+
+func TestTreeWalkSub(t *testing.T) {
+	tree := newTestTree(t)
+
+	var paths []string
+	err := tree.Walk(func(path string, value interface{}) error {
+		paths = append(paths, fmt.Sprintf("%s=%v", path, value))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	want := []string{
+		"DB/Host=db.prod",
+		"DB/Port=5432",
+		"DB/Timeout=5s",
+		"Debug=true",
+		"Env=prod",
+		"Hosts=[host1 host2]",
+		"Labels/team=core",
+	}
+
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("\nwant:\n%v\nhave:\n%v", want, paths)
+	}
+
+	db, err := tree.Sub("DB")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	err = db.Set("User", "admin")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	// Subtrees share the submaps of the tree
+	user, err := tree.GetString("DB/User")
+	if err != nil || user != "admin" {
+		t.Errorf("wrong DB/User: %s %v", user, err)
+	}
+
+	_, err = tree.Sub("Env")
+	if err == nil {
+		t.Errorf("Env is not a map")
+	}
+
+}
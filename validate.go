@@ -0,0 +1,316 @@
+package kvmapstruct
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// validateTagName is the struct tag holding validation rules.
+// Its format is `validate:"rule1,rule2=arg"`. Supported rules are:
+//
+//	nonempty       value must not be empty or zero
+//	min=N, max=N   bounds of a number, or of the length of a string, slice or map
+//	oneof=a b c    value must be one of the space separated values
+//	port           value must be a port number between 1 and 65535
+//	url            value must be an absolute URL
+//	regexp=EXPR    value must match the regular expression.
+//	               It must be the last rule because EXPR can contain commas.
+//
+// Except nonempty, min and max, rules on slices apply to each element.
+const validateTagName = "validate"
+
+// Validator is implemented by structs needing validation
+// across several fields. Validate is called after the struct
+// and its substructs were decoded and their fields validated.
+type Validator interface {
+	Validate() error
+}
+
+// ValidationError is a failed validation of a single Consul key.
+type ValidationError struct {
+	// Key is the Consul key of the value
+	Key string
+	// Field is the Go path of the field
+	Field string
+	// Rule is the failed rule or "validator" for Validator errors
+	Rule string
+	// Message describes the failure. Sensitive values are redacted
+	Message string
+}
+
+// Error implements error interface.
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("validation error at key %s: %s", e.Key, e.Message)
+}
+
+// ValidationErrors is the list of all failed validations of a struct.
+type ValidationErrors []*ValidationError
+
+// Error implements error interface.
+func (e ValidationErrors) Error() string {
+	var msgs []string
+
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+
+	return strings.Join(msgs, "\n")
+}
+
+// ValidateStruct checks the fields of a Go struct against their
+// validate tags, then calls Validate of the struct and substructs
+// implementing Validator. Errors cite the Consul key under prefix
+// the value comes from. st argument can be a Go struct or a pointer
+// to a Go struct. It returns ValidationErrors if any check fails.
+func ValidateStruct(st interface{}, prefix string) error {
+	var errs ValidationErrors
+
+	v := reflect.ValueOf(st)
+
+	for _, f := range structFields(v.Type(), prefix) {
+		tag, ok := f.Field.Tag.Lookup(validateTagName)
+		if !ok {
+			continue
+		}
+
+		fv, ok := f.value(v)
+		if !ok {
+			continue
+		}
+
+		sensitive := f.Options.Has("sensitive") || f.Options.Has("secret")
+
+		for _, rule := range parseRules(tag) {
+			errs = append(errs, checkRule(f, rule, f.Key, fv, sensitive)...)
+		}
+	}
+
+	errs = append(errs, callValidators(v, prefix, "")...)
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// parseRules splits a validate tag into rules.
+func parseRules(tag string) []string {
+	var rules []string
+
+	for tag != "" {
+		// regexp takes the rest of the tag
+		if strings.HasPrefix(tag, "regexp=") {
+			rules = append(rules, tag)
+			break
+		}
+
+		i := strings.Index(tag, ",")
+		if i < 0 {
+			rules = append(rules, tag)
+			break
+		}
+
+		if tag[:i] != "" {
+			rules = append(rules, tag[:i])
+		}
+
+		tag = tag[i+1:]
+	}
+
+	return rules
+}
+
+// checkRule checks a value against a rule. Rules other than nonempty,
+// min and max are checked against each element of slices.
+func checkRule(f structField, rule, key string, v reflect.Value, sensitive bool) ValidationErrors {
+	var errs ValidationErrors
+
+	name := rule
+	arg := ""
+
+	if i := strings.Index(rule, "="); i >= 0 {
+		name = rule[:i]
+		arg = rule[i+1:]
+	}
+
+	if v.Kind() == reflect.Slice && name != "nonempty" && name != "min" && name != "max" {
+		for i := 0; i < v.Len(); i++ {
+			errs = append(errs, checkRule(f, rule, key+"/"+strconv.Itoa(i), v.Index(i), sensitive)...)
+		}
+
+		return errs
+	}
+
+	msg := checkValue(name, arg, v)
+	if msg == "" {
+		return nil
+	}
+
+	val := redact(fmt.Sprint(v.Interface()), sensitive)
+
+	return ValidationErrors{
+		&ValidationError{
+			Key:     key,
+			Field:   f.Path,
+			Rule:    name,
+			Message: fmt.Sprintf("value %q %s", val, msg),
+		},
+	}
+}
+
+// checkValue checks a single value against a rule and returns
+// the failure message or an empty string if the check succeeds.
+func checkValue(name, arg string, v reflect.Value) string {
+	switch name {
+	case "nonempty":
+		if isEmptyValue(v) {
+			return "is empty"
+		}
+	case "min", "max":
+		bound, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return fmt.Sprintf("cannot be checked: invalid %s bound %s", name, arg)
+		}
+
+		size, what, ok := valueSize(v)
+		if !ok {
+			return fmt.Sprintf("cannot be checked: rule %s not supported for %s", name, v.Kind())
+		}
+
+		if name == "min" && size < bound {
+			return fmt.Sprintf("has a %s lower than %s", what, arg)
+		}
+
+		if name == "max" && size > bound {
+			return fmt.Sprintf("has a %s greater than %s", what, arg)
+		}
+	case "oneof":
+		s := fmt.Sprint(v.Interface())
+		for _, allowed := range strings.Fields(arg) {
+			if s == allowed {
+				return ""
+			}
+		}
+
+		return fmt.Sprintf("is not one of %s", arg)
+	case "port":
+		port, err := strconv.Atoi(fmt.Sprint(v.Interface()))
+		if err != nil || port < 1 || port > 65535 {
+			return "is not a port between 1 and 65535"
+		}
+	case "url":
+		u, err := url.Parse(fmt.Sprint(v.Interface()))
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return "is not an absolute URL"
+		}
+	case "regexp":
+		re, err := regexp.Compile(arg)
+		if err != nil {
+			return fmt.Sprintf("cannot be checked: invalid regexp %s", arg)
+		}
+
+		if !re.MatchString(fmt.Sprint(v.Interface())) {
+			return fmt.Sprintf("does not match %s", arg)
+		}
+	default:
+		return fmt.Sprintf("cannot be checked: unknown rule %s", name)
+	}
+
+	return ""
+}
+
+// valueSize returns the number to compare with min or max bounds:
+// the value of numbers or the length of strings, slices and maps.
+func valueSize(v reflect.Value) (float64, string, bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), "value", true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), "value", true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), "value", true
+	case reflect.String, reflect.Slice, reflect.Map:
+		return float64(v.Len()), "length", true
+	}
+
+	return 0, "", false
+}
+
+// isEmptyValue checks if v is the zero value of its type
+// or an empty slice or map.
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map, reflect.String:
+		return v.Len() == 0
+	}
+
+	return v.IsZero()
+}
+
+// callValidators calls Validate on v and its substructs, deepest first,
+// if they implement Validator.
+func callValidators(v reflect.Value, key, path string) ValidationErrors {
+	var errs ValidationErrors
+
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+
+		k := field.Name
+		if key != "" {
+			k = key + "/" + field.Name
+		}
+
+		p := field.Name
+		if path != "" {
+			p = path + "." + field.Name
+		}
+
+		errs = append(errs, callValidators(v.Field(i), k, p)...)
+	}
+
+	if !v.CanInterface() {
+		return errs
+	}
+
+	var validator Validator
+	if v.CanAddr() {
+		validator, _ = v.Addr().Interface().(Validator)
+	} else {
+		validator, _ = v.Interface().(Validator)
+	}
+
+	if validator == nil {
+		return errs
+	}
+
+	err := validator.Validate()
+	if err != nil {
+		errs = append(errs, &ValidationError{
+			Key:     key,
+			Field:   path,
+			Rule:    "validator",
+			Message: err.Error(),
+		})
+	}
+
+	return errs
+}
@@ -0,0 +1,167 @@
+package kvmapstruct
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+type validateDB struct {
+	Host     string `validate:"nonempty"`
+	Port     int    `validate:"port"`
+	Password string `kv:",sensitive" validate:"min=8"`
+	Replicas []string
+	Primary  string
+}
+
+// Validate checks that primary is one of the replicas.
+func (db *validateDB) Validate() error {
+	for _, r := range db.Replicas {
+		if r == db.Primary {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("primary %s is not a replica", db.Primary)
+}
+
+type validateST struct {
+	Name    string   `validate:"regexp=^[a-z]+(-[a-z]+){0,2}$"`
+	Env     string   `validate:"oneof=dev staging prod"`
+	Workers int      `validate:"min=1,max=16"`
+	URLs    []string `validate:"nonempty,url"`
+	DB      *validateDB
+}
+
+func TestValidateStruct(t *testing.T) {
+	testCases := []struct {
+		name   string
+		prefix string
+		input  *validateST
+		output []string
+	}{
+		{
+			"ValidStruct",
+			"test",
+			&validateST{
+				Name:    "my-service",
+				Env:     "prod",
+				Workers: 4,
+				URLs:    []string{"https://example.com"},
+				DB: &validateDB{
+					Host:     "localhost",
+					Port:     5432,
+					Password: "password",
+					Replicas: []string{"db1", "db2"},
+					Primary:  "db1",
+				},
+			},
+			nil,
+		},
+		{
+			"InvalidStruct",
+			"test",
+			&validateST{
+				Name:    "My_Service",
+				Env:     "qa",
+				Workers: 32,
+				URLs:    []string{"https://example.com", "example.com"},
+				DB: &validateDB{
+					Port:     70000,
+					Password: "secret",
+					Replicas: []string{"db1"},
+					Primary:  "db2",
+				},
+			},
+			[]string{
+				`validation error at key test/Name: value "My_Service" does not match ^[a-z]+(-[a-z]+){0,2}$`,
+				`validation error at key test/Env: value "qa" is not one of dev staging prod`,
+				`validation error at key test/Workers: value "32" has a value greater than 16`,
+				`validation error at key test/URLs/1: value "example.com" is not an absolute URL`,
+				`validation error at key test/DB/Host: value "" is empty`,
+				`validation error at key test/DB/Port: value "70000" is not a port between 1 and 65535`,
+				`validation error at key test/DB/Password: value "[redacted]" has a length lower than 8`,
+				`validation error at key test/DB: primary db2 is not a replica`,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var msgs []string
+
+			err := ValidateStruct(tc.input, tc.prefix)
+			if err != nil {
+				errs, ok := err.(ValidationErrors)
+				if !ok {
+					t.Fatalf("unexpected error type %T: %s", err, err)
+				}
+
+				for _, e := range errs {
+					msgs = append(msgs, e.Error())
+				}
+			}
+
+			if !reflect.DeepEqual(msgs, tc.output) {
+				t.Errorf("\nwant:\n%q\nhave:\n%q", tc.output, msgs)
+			}
+		})
+	}
+
+}
+
+func TestKVMapToStructValidation(t *testing.T) {
+	testCases := []struct {
+		name   string
+		prefix string
+		input  map[string]interface{}
+		err    string
+	}{
+		{
+			"ValidKVMap",
+			"test",
+			map[string]interface{}{
+				"test/Name":    "service",
+				"test/Env":     "dev",
+				"test/Workers": "2",
+				"test/URLs/0":  "http://localhost:8080",
+			},
+			"",
+		},
+		{
+			"InvalidKVMap",
+			"test",
+			map[string]interface{}{
+				"test/Name":    "service",
+				"test/Env":     "dev",
+				"test/Workers": "0",
+				"test/URLs/0":  "http://localhost:8080",
+			},
+			`validation error at key test/Workers: value "0" has a value lower than 1`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			type ST struct {
+				Name    string   `validate:"nonempty"`
+				Env     string   `validate:"oneof=dev staging prod"`
+				Workers int      `validate:"min=1,max=16"`
+				URLs    []string `validate:"url"`
+			}
+
+			st := &ST{}
+			msg := ""
+
+			err := KVMapToStruct(tc.input, tc.prefix, st)
+			if err != nil {
+				msg = err.Error()
+			}
+
+			if msg != tc.err {
+				t.Errorf("\nwant:\n%s\nhave:\n%s", tc.err, msg)
+			}
+		})
+	}
+
+}
@@ -0,0 +1,390 @@
+// Package vaultstore implements kvmapstruct.Store with the KV secrets
+// engine of HashiCorp Vault, version 1 or 2.
+//
+// Vault stores JSON documents per secret path instead of one value per
+// key. The first Depth segments of a key are the secret path under the
+// mount and the remaining segments are the field of the secret:
+// with Depth 2, the key app/prod/DB/Host is the field DB/Host of the
+// secret app/prod.
+//
+//	store, err := vaultstore.New("http://localhost:8200", token, "secret")
+//	store.Depth = 2
+//	cfg, err := kvmapstruct.Load[Config](ctx, store, "app/prod")
+package vaultstore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	vault "github.com/hashicorp/vault/api"
+	"github.com/spf13/cast"
+
+	"github.com/uthng/kvmapstruct/internal/kvpath"
+)
+
+// DefaultDepth is the default number of key segments of secret paths.
+const DefaultDepth = 1
+
+// Store contains Vault informations.
+type Store struct {
+	// Client is vault client
+	Client *vault.Client
+	// Mount is the mount path of the KV secrets engine
+	Mount string
+	// Version is the version of the KV secrets engine: 1 or 2
+	Version int
+	// Depth is the number of key segments of secret paths
+	Depth int
+}
+
+// Metadata contains the metadata of a KV v2 secret.
+type Metadata struct {
+	CurrentVersion int
+	OldestVersion  int
+	CreatedTime    time.Time
+	UpdatedTime    time.Time
+	Versions       map[int]VersionMetadata
+}
+
+// VersionMetadata contains the metadata of a version of a KV v2 secret.
+// DeletionTime is zero if the version is not deleted.
+type VersionMetadata struct {
+	CreatedTime  time.Time
+	DeletionTime time.Time
+	Destroyed    bool
+}
+
+// rawMetadata is the metadata of a KV v2 secret as returned by Vault.
+type rawMetadata struct {
+	CurrentVersion int    `json:"current_version"`
+	OldestVersion  int    `json:"oldest_version"`
+	CreatedTime    string `json:"created_time"`
+	UpdatedTime    string `json:"updated_time"`
+	Versions       map[int]struct {
+		CreatedTime  string `json:"created_time"`
+		DeletionTime string `json:"deletion_time"`
+		Destroyed    bool   `json:"destroyed"`
+	} `json:"versions"`
+}
+
+// New creates a new *Store for the KV v2 secrets engine mounted at mount.
+// Version and Depth can be changed afterwards.
+func New(address, token, mount string) (*Store, error) {
+	config := vault.DefaultConfig()
+
+	if address != "" {
+		config.Address = address
+	}
+
+	client, err := vault.NewClient(config)
+	if err != nil {
+		return nil, err
+	}
+
+	if token != "" {
+		client.SetToken(token)
+	}
+
+	return NewFromClient(client, mount), nil
+}
+
+// NewFromClient creates a new *Store for the KV v2 secrets engine
+// mounted at mount with an existing vault client.
+func NewFromClient(client *vault.Client, mount string) *Store {
+	return &Store{
+		Client:  client,
+		Mount:   strings.Trim(mount, "/"),
+		Version: 2,
+		Depth:   DefaultDepth,
+	}
+}
+
+// List implements kvmapstruct.Store. If prefix is shorter than Depth,
+// secrets under prefix are listed recursively.
+func (s *Store) List(ctx context.Context, prefix string) (map[string]interface{}, error) {
+	var secrets []string
+
+	m := make(map[string]interface{})
+	segments := kvpath.Split(prefix)
+
+	if len(segments) >= s.depth() {
+		secrets = []string{strings.Join(segments[:s.depth()], "/")}
+	} else {
+		var err error
+
+		secrets, err = s.listSecrets(ctx, strings.Join(segments, "/"), s.depth()-len(segments))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, secret := range secrets {
+		data, _, err := s.readSecret(ctx, secret, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		for field, v := range data {
+			k := secret + "/" + field
+			if kvpath.InPath(k, prefix) {
+				m[k] = cast.ToString(v)
+			}
+		}
+	}
+
+	return m, nil
+}
+
+// Put implements kvmapstruct.Store. Fields are merged into existing
+// secrets. With KV v2, each secret is written with check-and-set on the
+// version read before merging, so that concurrent writes fail instead
+// of being lost.
+func (s *Store) Put(ctx context.Context, kvmap map[string]interface{}) error {
+	secrets := make(map[string]map[string]interface{})
+
+	for k, v := range kvmap {
+		secret, field, err := s.split(k)
+		if err != nil {
+			return err
+		}
+
+		if secrets[secret] == nil {
+			secrets[secret] = make(map[string]interface{})
+		}
+
+		secrets[secret][field] = cast.ToString(v)
+	}
+
+	// Write secrets in order
+	paths := make([]string, 0, len(secrets))
+	for secret := range secrets {
+		paths = append(paths, secret)
+	}
+	sort.Strings(paths)
+
+	for _, secret := range paths {
+		data, version, err := s.readSecret(ctx, secret, 0)
+		if err != nil {
+			return err
+		}
+
+		if data == nil {
+			data = make(map[string]interface{})
+		}
+
+		for field, v := range secrets[secret] {
+			data[field] = v
+		}
+
+		err = s.writeSecret(ctx, secret, data, version)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ReadVersion gets a version of a KV v2 secret as a KV map.
+// Version 0 is the current version.
+func (s *Store) ReadVersion(ctx context.Context, secret string, version int) (map[string]interface{}, error) {
+	if s.Version != 2 {
+		return nil, fmt.Errorf("versions are only supported by KV v2")
+	}
+
+	secret = strings.Trim(secret, "/")
+	m := make(map[string]interface{})
+
+	data, _, err := s.readSecret(ctx, secret, version)
+	if err != nil {
+		return nil, err
+	}
+
+	for field, v := range data {
+		m[secret+"/"+field] = cast.ToString(v)
+	}
+
+	return m, nil
+}
+
+// Metadata gets the metadata of a KV v2 secret.
+// It returns nil if the secret does not exist.
+func (s *Store) Metadata(ctx context.Context, secret string) (*Metadata, error) {
+	if s.Version != 2 {
+		return nil, fmt.Errorf("metadata are only supported by KV v2")
+	}
+
+	resp, err := s.Client.Logical().ReadWithContext(ctx, s.Mount+"/metadata/"+strings.Trim(secret, "/"))
+	if err != nil || resp == nil {
+		return nil, err
+	}
+
+	// Decode through JSON to parse version numbers
+	b, err := json.Marshal(resp.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw rawMetadata
+
+	err = json.Unmarshal(b, &raw)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding metadata of %s: %s", secret, err)
+	}
+
+	md := &Metadata{
+		CurrentVersion: raw.CurrentVersion,
+		OldestVersion:  raw.OldestVersion,
+		CreatedTime:    parseTime(raw.CreatedTime),
+		UpdatedTime:    parseTime(raw.UpdatedTime),
+		Versions:       make(map[int]VersionMetadata),
+	}
+
+	for v, vm := range raw.Versions {
+		md.Versions[v] = VersionMetadata{
+			CreatedTime:  parseTime(vm.CreatedTime),
+			DeletionTime: parseTime(vm.DeletionTime),
+			Destroyed:    vm.Destroyed,
+		}
+	}
+
+	return md, nil
+}
+
+// readSecret gets the data of secret and its version. Version 0 reads
+// the current version. It returns nil data if the secret does not exist.
+func (s *Store) readSecret(ctx context.Context, secret string, version int) (map[string]interface{}, int, error) {
+	if s.Version != 2 {
+		resp, err := s.Client.Logical().ReadWithContext(ctx, s.Mount+"/"+secret)
+		if err != nil || resp == nil {
+			return nil, 0, err
+		}
+
+		return resp.Data, 0, nil
+	}
+
+	var params map[string][]string
+	if version > 0 {
+		params = map[string][]string{"version": {strconv.Itoa(version)}}
+	}
+
+	resp, err := s.Client.Logical().ReadWithDataWithContext(ctx, s.Mount+"/data/"+secret, params)
+	if err != nil || resp == nil {
+		return nil, 0, err
+	}
+
+	md, _ := resp.Data["metadata"].(map[string]interface{})
+	current := toInt(md["version"])
+
+	// Deleted versions have no data
+	data, _ := resp.Data["data"].(map[string]interface{})
+
+	return data, current, nil
+}
+
+// writeSecret writes the data of secret. With KV v2, the write only
+// succeeds if the current version of the secret is version.
+func (s *Store) writeSecret(ctx context.Context, secret string, data map[string]interface{}, version int) error {
+	var err error
+
+	if s.Version != 2 {
+		_, err = s.Client.Logical().WriteWithContext(ctx, s.Mount+"/"+secret, data)
+	} else {
+		_, err = s.Client.Logical().WriteWithContext(ctx, s.Mount+"/data/"+secret, map[string]interface{}{
+			"data": data,
+			"options": map[string]interface{}{
+				"cas": version,
+			},
+		})
+	}
+
+	if err != nil {
+		return fmt.Errorf("error writing secret %s: %s", secret, err)
+	}
+
+	return nil
+}
+
+// listSecrets lists recursively the secrets depth segments under dir.
+func (s *Store) listSecrets(ctx context.Context, dir string, depth int) ([]string, error) {
+	var secrets []string
+
+	path := s.Mount + "/" + dir
+	if s.Version == 2 {
+		path = s.Mount + "/metadata/" + dir
+	}
+
+	resp, err := s.Client.Logical().ListWithContext(ctx, path)
+	if err != nil || resp == nil {
+		return nil, err
+	}
+
+	keys, _ := resp.Data["keys"].([]interface{})
+
+	for _, k := range keys {
+		name := cast.ToString(k)
+		child := strings.TrimSuffix(name, "/")
+		if dir != "" {
+			child = dir + "/" + child
+		}
+
+		folder := strings.HasSuffix(name, "/")
+
+		switch {
+		case depth == 1 && !folder:
+			secrets = append(secrets, child)
+		case depth > 1 && folder:
+			sub, err := s.listSecrets(ctx, child, depth-1)
+			if err != nil {
+				return nil, err
+			}
+
+			secrets = append(secrets, sub...)
+		}
+	}
+
+	sort.Strings(secrets)
+
+	return secrets, nil
+}
+
+// split splits a key into its secret path and its field.
+func (s *Store) split(key string) (string, string, error) {
+	segments := kvpath.Split(key)
+	if len(segments) <= s.depth() {
+		return "", "", fmt.Errorf("key %s has no field after %d segments", key, s.depth())
+	}
+
+	return strings.Join(segments[:s.depth()], "/"), strings.Join(segments[s.depth():], "/"), nil
+}
+
+// depth returns Depth or DefaultDepth if it is not set.
+func (s *Store) depth() int {
+	if s.Depth <= 0 {
+		return DefaultDepth
+	}
+
+	return s.Depth
+}
+
+// parseTime parses a RFC 3339 time. Empty or invalid times are zero.
+func parseTime(s string) time.Time {
+	t, _ := time.Parse(time.RFC3339Nano, s)
+
+	return t
+}
+
+// toInt converts a number decoded by the vault client to an int.
+func toInt(v interface{}) int {
+	if n, ok := v.(json.Number); ok {
+		i, _ := n.Int64()
+		return int(i)
+	}
+
+	return cast.ToInt(v)
+}
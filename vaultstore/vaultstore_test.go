@@ -0,0 +1,330 @@
+package vaultstore
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/uthng/kvmapstruct/internal/storetest"
+)
+
+// fakeVault is a minimal stand-in of a Vault server with
+// a KV secrets engine mounted at secret.
+type fakeVault struct {
+	mu      sync.Mutex
+	v2      bool
+	secrets map[string][]map[string]interface{}
+	created time.Time
+}
+
+func newFakeVault(t *testing.T, version int) (*Store, *fakeVault, func()) {
+	fv := &fakeVault{
+		v2:      version == 2,
+		secrets: make(map[string][]map[string]interface{}),
+		created: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+
+	server := httptest.NewServer(fv)
+
+	store, err := New(server.URL, "token", "secret")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	store.Version = version
+
+	return store, fv, server.Close
+}
+
+func (fv *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fv.mu.Lock()
+	defer fv.mu.Unlock()
+
+	path := strings.TrimPrefix(r.URL.Path, "/v1/secret/")
+	kind := ""
+
+	if fv.v2 {
+		i := strings.Index(path, "/")
+		kind, path = path[:i], path[i+1:]
+	}
+
+	switch {
+	case r.URL.Query().Get("list") == "true":
+		fv.list(w, path)
+	case r.Method == http.MethodGet && kind == "metadata":
+		fv.metadata(w, path)
+	case r.Method == http.MethodGet:
+		fv.read(w, r, path)
+	case r.Method == http.MethodPut || r.Method == http.MethodPost:
+		fv.write(w, r, path)
+	default:
+		reply(w, http.StatusMethodNotAllowed, nil)
+	}
+}
+
+func (fv *fakeVault) list(w http.ResponseWriter, dir string) {
+	var keys []interface{}
+
+	seen := make(map[string]bool)
+	for path := range fv.secrets {
+		if dir != "" && !strings.HasPrefix(path, dir+"/") {
+			continue
+		}
+
+		rest := strings.TrimPrefix(path, dir+"/")
+		if dir == "" {
+			rest = path
+		}
+
+		name := rest
+		if i := strings.Index(rest, "/"); i >= 0 {
+			name = rest[:i+1]
+		}
+
+		if !seen[name] {
+			seen[name] = true
+			keys = append(keys, name)
+		}
+	}
+
+	if len(keys) == 0 {
+		reply(w, http.StatusNotFound, nil)
+		return
+	}
+
+	sort.Slice(keys, func(i, j int) bool { return keys[i].(string) < keys[j].(string) })
+
+	reply(w, http.StatusOK, map[string]interface{}{"keys": keys})
+}
+
+func (fv *fakeVault) read(w http.ResponseWriter, r *http.Request, path string) {
+	versions := fv.secrets[path]
+	if len(versions) == 0 {
+		reply(w, http.StatusNotFound, nil)
+		return
+	}
+
+	if !fv.v2 {
+		reply(w, http.StatusOK, versions[len(versions)-1])
+		return
+	}
+
+	version := len(versions)
+	if v := r.URL.Query().Get("version"); v != "" {
+		version, _ = strconv.Atoi(v)
+	}
+
+	if version < 1 || version > len(versions) {
+		reply(w, http.StatusNotFound, nil)
+		return
+	}
+
+	reply(w, http.StatusOK, map[string]interface{}{
+		"data": versions[version-1],
+		"metadata": map[string]interface{}{
+			"version":       version,
+			"created_time":  fv.created.Format(time.RFC3339Nano),
+			"deletion_time": "",
+			"destroyed":     false,
+		},
+	})
+}
+
+func (fv *fakeVault) metadata(w http.ResponseWriter, path string) {
+	versions := fv.secrets[path]
+	if len(versions) == 0 {
+		reply(w, http.StatusNotFound, nil)
+		return
+	}
+
+	vm := make(map[string]interface{})
+	for i := range versions {
+		vm[strconv.Itoa(i+1)] = map[string]interface{}{
+			"created_time":  fv.created.Format(time.RFC3339Nano),
+			"deletion_time": "",
+			"destroyed":     false,
+		}
+	}
+
+	reply(w, http.StatusOK, map[string]interface{}{
+		"current_version": len(versions),
+		"oldest_version":  1,
+		"created_time":    fv.created.Format(time.RFC3339Nano),
+		"updated_time":    fv.created.Format(time.RFC3339Nano),
+		"versions":        vm,
+	})
+}
+
+func (fv *fakeVault) write(w http.ResponseWriter, r *http.Request, path string) {
+	var body map[string]interface{}
+
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		reply(w, http.StatusBadRequest, nil)
+		return
+	}
+
+	if !fv.v2 {
+		fv.secrets[path] = []map[string]interface{}{body}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	options, _ := body["options"].(map[string]interface{})
+	if cas, ok := options["cas"].(float64); ok && int(cas) != len(fv.secrets[path]) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"errors": []string{"check-and-set parameter did not match the current version"},
+		})
+		return
+	}
+
+	data, _ := body["data"].(map[string]interface{})
+	fv.secrets[path] = append(fv.secrets[path], data)
+
+	reply(w, http.StatusOK, map[string]interface{}{"version": len(fv.secrets[path])})
+}
+
+func reply(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if data == nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{"errors": []string{}})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+}
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+
+	testCases := []struct {
+		name    string
+		version int
+	}{
+		{"KVv2", 2},
+		{"KVv1", 1},
+	}
+
+	// Secrets are app/prod and app/prod2 with a depth of 2
+	want := map[string]interface{}{
+		"Env":     "prod",
+		"Hosts/0": "host1",
+		"Hosts/1": "host2",
+		"DB/Host": "db.prod",
+		"DB/Port": "5432",
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			store, fv, stop := newFakeVault(t, tc.version)
+			defer stop()
+
+			store.Depth = 2
+
+			storetest.Run(t, store, "app/prod")
+
+			versions := fv.secrets["app/prod"]
+			if len(versions) == 0 || !reflect.DeepEqual(versions[len(versions)-1], want) {
+				t.Errorf("\nwant:\n%v\nhave:\n%v", want, versions)
+			}
+
+			// Secrets are listed recursively under short prefixes
+			m, err := store.List(ctx, "app")
+			if err != nil {
+				t.Fatalf("%s", err)
+			}
+
+			if len(m) != len(want)+1 || m["app/prod2/Env"] != "other" {
+				t.Errorf("wrong secrets under app: %v", m)
+			}
+		})
+	}
+
+}
+
+func TestStoreKeyWithoutField(t *testing.T) {
+	store, _, stop := newFakeVault(t, 2)
+	defer stop()
+
+	store.Depth = 3
+
+	err := store.Put(context.Background(), map[string]interface{}{"app/prod/Env": "prod"})
+	if err == nil || !strings.Contains(err.Error(), "no field") {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+}
+
+func TestStoreVersions(t *testing.T) {
+	ctx := context.Background()
+
+	store, fv, stop := newFakeVault(t, 2)
+	defer stop()
+
+	for _, host := range []string{"db1", "db2"} {
+		err := store.Put(ctx, map[string]interface{}{"app/DB/Host": host})
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+	}
+
+	// Fields are merged into the existing secret
+	err := store.Put(ctx, map[string]interface{}{"app/Env": "prod"})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	testCases := []struct {
+		name    string
+		version int
+		output  map[string]interface{}
+	}{
+		{"Current", 0, map[string]interface{}{"app/DB/Host": "db2", "app/Env": "prod"}},
+		{"First", 1, map[string]interface{}{"app/DB/Host": "db1"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := store.ReadVersion(ctx, "app", tc.version)
+			if err != nil {
+				t.Fatalf("%s", err)
+			}
+
+			if !reflect.DeepEqual(m, tc.output) {
+				t.Errorf("\nwant:\n%v\nhave:\n%v", tc.output, m)
+			}
+		})
+	}
+
+	md, err := store.Metadata(ctx, "app")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if md.CurrentVersion != 3 || len(md.Versions) != 3 || !md.CreatedTime.Equal(fv.created) || !md.Versions[1].DeletionTime.IsZero() {
+		t.Errorf("wrong metadata: %+v", md)
+	}
+
+	// Concurrent writes fail on check-and-set
+	err = store.writeSecret(ctx, "app", map[string]interface{}{"Env": "dev"}, 1)
+	if err == nil || !strings.Contains(err.Error(), "check-and-set") {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	md, err = store.Metadata(ctx, "missing")
+	if err != nil || md != nil {
+		t.Errorf("unexpected metadata: %v %v", md, err)
+	}
+
+}